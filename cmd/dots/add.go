@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/installer"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+var addCmd = cobra.Command{
+	Use:   "add <installed-path...>",
+	Short: "Copy existing files into a group of the sources",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		group, _ := cmd.Flags().GetString("group")
+		ignore, _ := cmd.Flags().GetStringSlice("ignore")
+
+		if !slices.Contains(sourceConfig.Groups, group) {
+			return fmt.Errorf("%q is not a group of the source configuration", group)
+		}
+
+		installed := map[string]*resolver.Dotfile{}
+
+		for _, dotfile := range resolver.ResolveDotfiles(*sourceConfig, *sourceLockfile) {
+			if !dotfile.Removed && !dotfile.Suppressed {
+				installed[destination(dotfile)] = dotfile
+			}
+		}
+
+		added := []string{}
+		failed := false
+
+		for _, arg := range args {
+			files, err := addPaths(arg, ignore)
+			if err != nil {
+				color.New(color.FgRed).Printf("%s: %s\n", arg, err)
+				failed = true
+				continue
+			}
+
+			for _, file := range files {
+				if dotfile, ok := installed[file]; ok {
+					color.New(color.FgRed).Printf("%s: already installed as %s\n", file, dotfile.DisplayPath())
+					failed = true
+					continue
+				}
+
+				dotfilePath, err := sourceDotfilePath(file)
+				if err != nil {
+					color.New(color.FgRed).Printf("%s: %s\n", file, err)
+					failed = true
+					continue
+				}
+
+				sourcePath, err := installer.AddSource(file, group, dotfilePath, sourceConfig)
+				if err != nil {
+					color.New(color.FgRed).Printf("%s: %s\n", file, err)
+					failed = true
+					continue
+				}
+
+				fmt.Printf("added %s as %s\n", file, sourcePath)
+				added = append(added, file)
+			}
+		}
+
+		installConfig := installer.InstallConfig{
+			SourceConfig:   sourceConfig,
+			SourceLockfile: sourceLockfile,
+		}
+
+		// Added files are recorded as installed by the dotfiles they now
+		// resolve to, so that they are not reported as overwriting existing
+		// files when next installed.
+		resolved := map[string]*resolver.Dotfile{}
+
+		for _, dotfile := range resolver.ResolveDotfiles(*sourceConfig, *sourceLockfile) {
+			if !dotfile.Removed && !dotfile.Suppressed {
+				resolved[destination(dotfile)] = dotfile
+			}
+		}
+
+		for _, file := range added {
+			dotfile, ok := resolved[file]
+			if !ok {
+				color.New(color.FgYellow).Printf("%s: not installed by the active groups, not recorded as installed\n", file)
+				continue
+			}
+
+			if err := installer.RecordInstalled(dotfile, installConfig); err != nil {
+				color.New(color.FgRed).Printf("%s: %s\n", file, err)
+				failed = true
+			}
+		}
+
+		if err := config.WriteLockfile(sourceLockfile, sourceConfig); err != nil {
+			return fmt.Errorf("finalization error: %s", err)
+		}
+
+		if failed {
+			return fmt.Errorf("some files could not be added")
+		}
+
+		return nil
+	},
+	Args: cobra.MinimumNArgs(1),
+}
+
+// addPaths lists the files to add at the path, walking directories. Files and
+// directories matching an ignore pattern, relative to the walked directory,
+// are skipped, as is the directory containing the lockfile.
+func addPaths(addPath string, ignore []string) ([]string, error) {
+	root, err := filepath.Abs(addPath)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Lstat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{root}, nil
+	}
+
+	lockfileDir := filepath.Dir(sourceConfig.LockfilePath)
+	files := []string{}
+
+	walk := func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+
+		ignored := slices.ContainsFunc(ignore, func(pattern string) bool {
+			return config.MatchPattern(pattern, filepath.ToSlash(relative))
+		})
+
+		if file == lockfileDir || (relative != "." && ignored) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if !entry.IsDir() {
+			files = append(files, file)
+		}
+
+		return nil
+	}
+
+	if err := filepath.WalkDir(root, walk); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// sourceDotfilePath determines the path of the dotfile installed at the
+// absolute path. Files installed into an install target with a directory are
+// within that directory of each group.
+func sourceDotfilePath(file string) (string, error) {
+	root, directory := "", ""
+
+	if isWithin(sourceConfig.InstallPath, file) {
+		root = sourceConfig.InstallPath
+	}
+
+	// The most specific directory containing the file is used
+	for _, target := range sourceConfig.Targets {
+		if target.Directory != "" && len(target.Path) > len(root) && isWithin(target.Path, file) {
+			root, directory = target.Path, target.Directory
+		}
+	}
+
+	if root == "" {
+		return "", fmt.Errorf("not within the install path, or the path of an install target")
+	}
+
+	relative, err := filepath.Rel(root, file)
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(directory, filepath.ToSlash(relative)), nil
+}
+
+// isWithin reports if the file is within the directory.
+func isWithin(directory, file string) bool {
+	return strings.HasPrefix(file, filepath.Clean(directory)+string(filepath.Separator))
+}
+
+func init() {
+	flags := addCmd.Flags()
+	flags.StringP("group", "g", "", "group to copy the files into")
+	flags.StringSliceP("ignore", "i", nil, "glob patterns of files to skip when adding directories")
+
+	addCmd.MarkFlagRequired("group")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/installer"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+var adoptCmd = cobra.Command{
+	Use:   "adopt <path...>",
+	Short: "Copy edits made to installed dotfiles back into their sources",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dotfiles := resolver.ResolveDotfiles(*sourceConfig, *sourceLockfile)
+
+		installConfig := installer.InstallConfig{
+			SourceConfig:   sourceConfig,
+			SourceLockfile: sourceLockfile,
+		}
+
+		failed := false
+
+		for _, path := range args {
+			dotfile, err := findInstalledDotfile(dotfiles, path)
+			if err != nil {
+				color.New(color.FgRed).Printf("%s: %s\n", path, err)
+				failed = true
+				continue
+			}
+
+			changed, err := installer.AdoptDotfile(dotfile, installConfig)
+			if err != nil {
+				color.New(color.FgRed).Printf("%s: %s\n", dotfile.DisplayPath(), err)
+				failed = true
+				continue
+			}
+
+			if len(changed) == 0 {
+				color.New(color.FgHiBlack).Printf("%s: sources already match\n", dotfile.DisplayPath())
+				continue
+			}
+
+			fmt.Printf("adopted %s into %s\n", dotfile.DisplayPath(), strings.Join(changed, ", "))
+		}
+
+		// The state of adopted dotfiles is updated so they are no longer
+		// considered locally modified.
+		if err := config.WriteLockfile(sourceLockfile, sourceConfig); err != nil {
+			return fmt.Errorf("finalization error: %s", err)
+		}
+
+		if failed {
+			return fmt.Errorf("some dotfiles could not be adopted")
+		}
+
+		return nil
+	},
+	Args: cobra.MinimumNArgs(1),
+}
+
+// findInstalledDotfile finds the dotfile installed at the path. Relative paths
+// are relative to the working directory, or may be the path of the dotfile as
+// listed by `dots files`.
+func findInstalledDotfile(dotfiles resolver.Dotfiles, path string) (*resolver.Dotfile, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dotfile := range dotfiles {
+		if destination(dotfile) == absolute || dotfile.DisplayPath() == path {
+			return dotfile, nil
+		}
+	}
+
+	return nil, fmt.Errorf("not an installed dotfile")
+}
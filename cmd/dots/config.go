@@ -60,6 +60,32 @@ var configActiveCmd = cobra.Command{
 	Args: cobra.NoArgs,
 }
 
+var configVarsCmd = cobra.Command{
+	Use:   "vars",
+	Short: "Shows the effective variables and where they were defined",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		variables := sourceLockfile.ResolveVariables(*sourceConfig)
+		names := variables.Names()
+
+		maxNameLength := 0
+		for _, name := range names {
+			if len(name) > maxNameLength {
+				maxNameLength = len(name)
+			}
+		}
+
+		for _, name := range names {
+			variable := variables[name]
+
+			fmt.Printf("%-*s %v ", maxNameLength, name, variable.Value)
+			color.New(color.FgHiBlack).Printf("[%s]\n", variable.Source)
+		}
+
+		return nil
+	},
+	Args: cobra.NoArgs,
+}
+
 var configUseCmd = cobra.Command{
 	Use:   "use [profile]",
 	Short: "Enable a specific profile for this host",
@@ -117,5 +143,6 @@ func init() {
 	configCmd.AddCommand(&configProfilesCmd)
 	configCmd.AddCommand(&configGroupsCmd)
 	configCmd.AddCommand(&configActiveCmd)
+	configCmd.AddCommand(&configVarsCmd)
 	configCmd.AddCommand(&configClearCmd)
 }
@@ -45,9 +45,47 @@ var diffCmd = cobra.Command{
 		}
 		defer os.Remove(prettyLink)
 
+		// Dotfiles of other install targets are staged into their own
+		// directories. This includes targets which are no longer configured,
+		// so that their removed dotfiles are not removed while diffing.
+		targetTmps := map[string]string{}
+
+		targets := []string{}
+		for name := range sourceConfig.Targets {
+			targets = append(targets, name)
+		}
+		for name := range sourceLockfile.InstalledTargets {
+			targets = append(targets, name)
+		}
+
+		for _, name := range targets {
+			if _, ok := targetTmps[name]; ok {
+				continue
+			}
+
+			targetTmp, err := os.MkdirTemp("", "dots-target")
+			if err != nil {
+				return fmt.Errorf("failed to create tmp directory: %s", err)
+			}
+			defer os.RemoveAll(targetTmp)
+
+			targetTmps[name] = targetTmp
+		}
+
+		// Managed links are staged within a directory mirroring their
+		// absolute path.
+		linkTmp, err := os.MkdirTemp("", "dots-links")
+		if err != nil {
+			return fmt.Errorf("failed to create tmp directory: %s", err)
+		}
+		defer os.RemoveAll(linkTmp)
+
 		installConfig := installer.InstallConfig{
 			SourceConfig:        sourceConfig,
+			SourceLockfile:      sourceLockfile,
 			OverrideInstallPath: sourceTmp,
+			OverrideTargetPaths: targetTmps,
+			OverrideLinkPath:    linkTmp,
 		}
 
 		// No need to output any logging, but we must process the events.
@@ -57,18 +95,40 @@ var diffCmd = cobra.Command{
 		defer noopLogger.LogEvents()()
 
 		dotfiles := resolver.ResolveDotfiles(*sourceConfig, *sourceLockfile)
-		prepared := installer.PrepareDotfiles(dotfiles.Filter(files), *sourceConfig)
+		prepared := installer.PrepareDotfiles(dotfiles.Filter(files), *sourceConfig, *sourceLockfile)
 		installer.InstallDotfiles(prepared, installConfig)
 
-		git := []string{"diff", "--no-index", "--diff-filter=MA"}
-		git = append(git, flags...)
-		git = append(git, "--", sourceConfig.InstallPath, prettyLink+"/")
+		gitDiff(flags, "", sourceConfig.InstallPath, prettyLink+"/")
 
-		command := exec.Command("git", git...)
-		command.Stdout = os.Stdout
-		command.Stderr = os.Stderr
+		// Install targets are commonly directories with many other files,
+		// such as the home directory, so only the staged dotfiles of the
+		// target, and staged managed links, are compared.
+		for _, dotfile := range prepared.Dotfiles {
+			if (dotfile.InstallTarget == "" && !dotfile.ManagedLink) || dotfile.Removed {
+				continue
+			}
+
+			if !installer.WillInstallDotfile(dotfile, installConfig) {
+				continue
+			}
+
+			installed := sourceLockfile.TargetPath(*sourceConfig, dotfile.InstallTarget) +
+				string(os.PathSeparator) + dotfile.Path
+			stagingDir, staged := targetTmps[dotfile.InstallTarget], dotfile.Path
+
+			if dotfile.ManagedLink {
+				installed = dotfile.Path
+				stagingDir, staged = linkTmp, strings.TrimPrefix(dotfile.Path, string(os.PathSeparator))
+			}
 
-		command.Run()
+			if _, err := os.Lstat(installed); os.IsNotExist(err) {
+				installed = os.DevNull
+			}
+
+			// The staged dotfile is compared relative to the staging
+			// directory so the tmp directory is not included in the diff.
+			gitDiff(flags, stagingDir, installed, staged)
+		}
 
 		return nil
 	},
@@ -77,3 +137,18 @@ var diffCmd = cobra.Command{
 	DisableFlagsInUseLine: true,
 	DisableFlagParsing:    true,
 }
+
+// gitDiff outputs the modified and added files between the two paths. The
+// diff is executed within the directory, when specified.
+func gitDiff(flags []string, dir, installed, staged string) {
+	git := []string{"diff", "--no-index", "--diff-filter=MA"}
+	git = append(git, flags...)
+	git = append(git, "--", installed, staged)
+
+	command := exec.Command("git", git...)
+	command.Dir = dir
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	command.Run()
+}
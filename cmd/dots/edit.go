@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+var editCmd = cobra.Command{
+	Use:   "edit <dotfile-path>",
+	Short: "Edit a source of a dotfile and install it",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		group, _ := cmd.Flags().GetString("group")
+
+		if group != "" && !slices.Contains(sourceConfig.Groups, group) {
+			return fmt.Errorf("%q is not a group of the source configuration", group)
+		}
+
+		// Layers of inactive groups are never installed
+		if group != "" && !slices.Contains(sourceLockfile.ResolveGroups(*sourceConfig), group) {
+			return fmt.Errorf("%q is not an active group, its layers are not installed", group)
+		}
+
+		dotfiles := resolver.ResolveDotfiles(*sourceConfig, *sourceLockfile)
+
+		dotfile, err := findInstalledDotfile(dotfiles, args[0])
+		if err != nil {
+			return err
+		}
+
+		if dotfile.ManagedLink || len(dotfile.Sources) == 0 {
+			return fmt.Errorf("%s is not installed from sources", dotfile.DisplayPath())
+		}
+
+		source := editSource(dotfile, group)
+
+		if source == "" {
+			fmt.Printf("%s has multiple source layers:\n", dotfile.DisplayPath())
+			printSources(dotfile)
+
+			return fmt.Errorf("choose the layer to edit with --group")
+		}
+
+		path := filepath.Join(sourceConfig.SourcePath, source)
+
+		_, err = os.Lstat(path)
+		created := os.IsNotExist(err)
+
+		if err != nil && !created {
+			return err
+		}
+
+		if created {
+			if err := os.MkdirAll(filepath.Dir(path), config.DefaultDirectoryMode); err != nil {
+				return err
+			}
+
+			color.New(color.FgHiBlack).Printf("creating %s\n", source)
+		}
+
+		if err := runEditor(path); err != nil {
+			return fmt.Errorf("editor failed: %s", err)
+		}
+
+		if _, err := os.Lstat(path); created && os.IsNotExist(err) {
+			fmt.Printf("%s was not saved, nothing to install\n", source)
+			return nil
+		}
+
+		// New layers have the mode of the layer below them, so the sources
+		// of the dotfile are consistent.
+		if created {
+			info, err := os.Stat(filepath.Join(sourceConfig.SourcePath, dotfile.Sources[0].Path))
+			if err != nil {
+				return err
+			}
+
+			if err := os.Chmod(path, info.Mode()&os.ModePerm); err != nil {
+				return err
+			}
+		}
+
+		// The dotfile is resolved again as the edit may have added a layer
+		edited := resolver.Dotfiles{}
+
+		for _, resolved := range resolver.ResolveDotfiles(*sourceConfig, *sourceLockfile) {
+			if resolved.Path == dotfile.Path && resolved.InstallTarget == dotfile.InstallTarget {
+				edited = append(edited, resolved)
+			}
+		}
+
+		return runInstall(edited, installOptions{})
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+// editSource determines the path of the source of the dotfile to edit within
+// the group. The source is created in the group when it has none. Without a
+// group, the only source of the dotfile is edited, and an empty path is
+// returned when it has multiple sources.
+func editSource(dotfile *resolver.Dotfile, group string) string {
+	if group == "" {
+		if len(dotfile.Sources) != 1 {
+			return ""
+		}
+
+		return dotfile.Sources[0].Path
+	}
+
+	for _, source := range dotfile.Sources {
+		if source.Group == group {
+			return source.Path
+		}
+	}
+
+	// The dotfile has the same path within every group, without the suffixes
+	// marking the kind of source.
+	source := dotfile.Sources[0]
+	path := strings.TrimPrefix(source.Path, source.Group+"/")
+
+	switch {
+	case source.Override:
+		path = strings.TrimSuffix(path, "."+sourceConfig.OverrideSuffix)
+	case source.Patch:
+		path = strings.TrimSuffix(path, "."+sourceConfig.PatchSuffix)
+	case source.Template && sourceConfig.TemplateSuffix != "":
+		path = strings.TrimSuffix(path, "."+sourceConfig.TemplateSuffix)
+	}
+
+	return group + "/" + path
+}
+
+// runEditor opens the file in the editor specified by $EDITOR, waiting for
+// the editor to exit.
+func runEditor(path string) error {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// The editor may include arguments, such as `code --wait`
+	command := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	return command.Run()
+}
+
+func init() {
+	flags := editCmd.Flags()
+	flags.StringP("group", "g", "", "group of the source layer to edit, created when missing")
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
+	"go.evanpurkhiser.com/dots/config"
 	"go.evanpurkhiser.com/dots/resolver"
 )
 
@@ -13,10 +17,203 @@ var filesCmd = cobra.Command{
 	Use:   "files [filter...]",
 	Short: "List resolved dotfile paths",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		dotfiles := resolver.ResolveDotfiles(*sourceConfig, *sourceLockfile)
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		explain, _ := cmd.Flags().GetBool("explain")
 
-		fmt.Println(strings.Join(dotfiles.Filter(args).Files(), "\n"))
+		dotfiles := resolver.ResolveDotfiles(*sourceConfig, *sourceLockfile).Filter(args)
+
+		warnCollisions(dotfiles)
+
+		if !verbose && !explain {
+			for _, dotfile := range dotfiles {
+				if !dotfile.Suppressed {
+					fmt.Println(destination(dotfile))
+				}
+			}
+
+			return nil
+		}
+
+		for _, dotfile := range dotfiles {
+			if dotfile.Suppressed {
+				color.New(color.FgHiBlack).Printf(
+					"%s (suppressed by %s)\n",
+					destination(dotfile),
+					dotfile.SuppressedBy,
+				)
+				continue
+			}
+
+			switch {
+			case dotfile.ManagedLink && !dotfile.Removed:
+				fmt.Print(destination(dotfile))
+				color.New(color.FgHiBlack).Printf(" (link to %s)\n", dotfile.LinkedDotfile)
+			case dotfile.OriginalPath != "":
+				fmt.Print(destination(dotfile))
+				color.New(color.FgHiBlack).Printf(" (from %s)\n", dotfile.OriginalPath)
+			default:
+				fmt.Println(destination(dotfile))
+			}
+
+			if verbose {
+				printSources(dotfile)
+			}
+
+			if explain {
+				printRules(dotfile)
+			}
+		}
 
 		return nil
 	},
 }
+
+// destination returns the absolute path the dotfile is installed at.
+func destination(dotfile *resolver.Dotfile) string {
+	if dotfile.ManagedLink {
+		return dotfile.Path
+	}
+
+	return filepath.Join(sourceLockfile.TargetPath(*sourceConfig, dotfile.InstallTarget), dotfile.Path)
+}
+
+// warnCollisions prints a warning for each dotfile which was not moved to the
+// path of its file rule or install target, as another dotfile claims it.
+func warnCollisions(dotfiles resolver.Dotfiles) {
+	for _, dotfile := range dotfiles {
+		if dotfile.Collision == "" {
+			continue
+		}
+
+		color.New(color.FgYellow).Fprintf(
+			os.Stderr,
+			"warn: %s is not moved to %s, the path is claimed by %s\n",
+			dotfile.DisplayPath(),
+			dotfile.Collision,
+			claimant(dotfile),
+		)
+	}
+}
+
+// claimant describes the dotfile claiming the path the dotfile collided with.
+func claimant(dotfile *resolver.Dotfile) string {
+	if dotfile.CollidesWith == "" {
+		return "another dotfile"
+	}
+
+	return dotfile.CollidesWith
+}
+
+// printSources prints the source layers of the dotfile.
+func printSources(dotfile *resolver.Dotfile) {
+	discarded, overriddenBy := dotfile.DiscardedSources()
+
+	for _, source := range discarded {
+		color.New(color.FgHiBlack).Printf(
+			"  %s (discarded, overridden by %s)\n",
+			source.Path,
+			overriddenBy.Path,
+		)
+	}
+
+	for _, source := range dotfile.ActiveSources() {
+		fmt.Printf("  %s\n", source.Path)
+	}
+}
+
+// printRules prints the file rules matching the path of the dotfile. Rules
+// which were skipped due to their conditions are also listed.
+func printRules(dotfile *resolver.Dotfile) {
+	// Removed dotfiles no longer have sources for rules to apply to
+	if dotfile.Removed {
+		return
+	}
+
+	path := dotfile.Path
+	if dotfile.OriginalPath != "" {
+		path = dotfile.OriginalPath
+	}
+
+	applied := map[int]bool{}
+	for _, index := range dotfile.Rules {
+		applied[index] = true
+	}
+
+	for i, rule := range sourceConfig.Files {
+		if !rule.Matches(path) {
+			continue
+		}
+
+		if !applied[i] {
+			color.New(color.FgHiBlack).Printf(
+				"  rule #%d %s (skipped, when %s)\n",
+				i+1,
+				rule.Match,
+				strings.Join(rule.When, ", "),
+			)
+			continue
+		}
+
+		fmt.Printf("  rule #%d %s", i+1, rule.Match)
+		color.New(color.FgHiBlack).Printf(" %s", describeRule(rule))
+
+		if (rule.Target != "" || rule.InstallTarget != "") && dotfile.Collision != "" {
+			color.New(color.FgYellow).Printf(" (%s is claimed by %s)", dotfile.Collision, claimant(dotfile))
+		}
+
+		fmt.Println()
+	}
+}
+
+// describeRule describes the options set by a file rule.
+func describeRule(rule config.FileRule) string {
+	options := []string{}
+
+	option := func(name string, value *bool) {
+		if value == nil {
+			return
+		}
+
+		if !*value {
+			name = "no " + name
+		}
+
+		options = append(options, name)
+	}
+
+	if rule.Mode != "" {
+		options = append(options, "mode "+rule.Mode)
+	}
+
+	option("expand_environment", rule.ExpandEnvironment)
+	option("template", rule.Template)
+	option("preserve_whitespace", rule.PreserveWhitespace)
+
+	if rule.Merge != "" {
+		options = append(options, "merge "+string(rule.Merge))
+	}
+
+	if rule.InstallMode != "" {
+		options = append(options, "install_mode "+string(rule.InstallMode))
+	}
+
+	if rule.Target != "" {
+		options = append(options, "target "+rule.Target)
+	}
+
+	if rule.InstallTarget != "" {
+		options = append(options, "install_target "+rule.InstallTarget)
+	}
+
+	if len(rule.When) > 0 {
+		options = append(options, "when "+strings.Join(rule.When, ", "))
+	}
+
+	return "[" + strings.Join(options, "; ") + "]"
+}
+
+func init() {
+	flags := filesCmd.Flags()
+	flags.BoolP("verbose", "v", false, "list the source layers of each dotfile")
+	flags.BoolP("explain", "e", false, "list the file rules matching each dotfile")
+}
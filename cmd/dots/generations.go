@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"go.evanpurkhiser.com/dots/installer"
+)
+
+var generationsCmd = cobra.Command{
+	Use:   "generations",
+	Short: "List the recorded install generations",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		prune, _ := cmd.Flags().GetInt("prune")
+
+		if cmd.Flags().Changed("prune") {
+			if prune < 1 {
+				return fmt.Errorf("at least the latest generation must be kept")
+			}
+
+			removed, err := installer.PruneGenerations(sourceConfig, sourceLockfile, prune)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("removed %d generations\n", removed)
+			return nil
+		}
+
+		generations, err := installer.ListGenerations(sourceConfig)
+		if err != nil {
+			return err
+		}
+
+		for i, generation := range generations {
+			current := " "
+			if i == len(generations)-1 {
+				current = "*"
+			}
+
+			fmt.Printf("%s %3d  %s", current, generation.Number, generation.Created.Format("2006-01-02 15:04:05"))
+
+			details := color.New(color.FgHiBlack)
+
+			if generation.Revision != "" {
+				details.Printf("  %.12s", generation.Revision)
+			}
+
+			details.Printf("  %d files", len(generation.Files))
+
+			if generation.RollbackOf != 0 {
+				details.Printf("  (rollback to %d)", generation.RollbackOf)
+			}
+
+			fmt.Println()
+
+			if verbose {
+				for _, file := range generation.Files {
+					details.Printf("      %s\n", file.Path)
+				}
+			}
+		}
+
+		return nil
+	},
+	Args: cobra.NoArgs,
+}
+
+func init() {
+	flags := generationsCmd.Flags()
+	flags.BoolP("verbose", "v", false, "list the files installed by each generation")
+	flags.IntP("prune", "p", 0, "remove all but the latest n generations, along with their stored files")
+}
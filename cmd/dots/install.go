@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 
 	"go.evanpurkhiser.com/dots/installer"
@@ -10,64 +11,195 @@ import (
 	"go.evanpurkhiser.com/dots/resolver"
 )
 
+// installOptions specifies how dotfiles are installed by runInstall.
+type installOptions struct {
+	reinstall       bool
+	verbose         bool
+	dryRun          bool
+	atomic          bool
+	conflicts       installer.ConflictMode
+	conflictMarkers bool
+}
+
 var installCmd = cobra.Command{
 	Use:   "install [filter...]",
 	Short: "Install and compile dotfiles from sources",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		forceReInstall, _ := cmd.Flags().GetBool("reinstall")
-		verbose, _ := cmd.Flags().GetBool("verbose")
-		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		options := installOptions{}
 
-		if dryRun {
-			verbose = true
+		options.reinstall, _ = cmd.Flags().GetBool("reinstall")
+		options.verbose, _ = cmd.Flags().GetBool("verbose")
+		options.dryRun, _ = cmd.Flags().GetBool("dry-run")
+		options.atomic, _ = cmd.Flags().GetBool("atomic")
+		options.conflictMarkers, _ = cmd.Flags().GetBool("conflict-markers")
+
+		conflicts, err := conflictMode(cmd)
+		if err != nil {
+			return err
 		}
 
+		options.conflicts = conflicts
+
 		dotfiles := resolver.ResolveDotfiles(*sourceConfig, *sourceLockfile).Filter(args)
-		prepared := installer.PrepareDotfiles(dotfiles, *sourceConfig)
 
-		installConfig := installer.InstallConfig{
-			SourceConfig:   sourceConfig,
-			SourceLockfile: sourceLockfile,
-			ForceReinstall: forceReInstall,
+		return runInstall(dotfiles, options)
+	},
+	Args: cobra.ArbitraryArgs,
+}
+
+// runInstall prepares and installs the dotfiles, running their install
+// scripts, and records the install in the lockfile.
+func runInstall(dotfiles resolver.Dotfiles, options installOptions) error {
+	verbose := options.verbose || options.dryRun
+
+	warnCollisions(dotfiles)
+
+	prepared := installer.PrepareDotfiles(dotfiles, *sourceConfig, *sourceLockfile)
+
+	installConfig := installer.InstallConfig{
+		SourceConfig:    sourceConfig,
+		SourceLockfile:  sourceLockfile,
+		ForceReinstall:  options.reinstall,
+		Conflicts:       options.conflicts,
+		ConflictMarkers: options.conflictMarkers,
+		Backups:         installer.NewBackupRun(sourceConfig),
+	}
+
+	installLogger := output.New(output.Config{
+		SourceConfig:    *sourceConfig,
+		InstallConfig:   installConfig,
+		PreparedInstall: prepared,
+		IsVerbose:       verbose,
+	})
+
+	installConfig.EventLogger = installLogger.GetEventChan()
+
+	installLogger.InstallInfo()
+
+	if options.dryRun {
+		installLogger.DryrunInstall()
+		return nil
+	}
+
+	// An atomic install is not started when any dotfile cannot be
+	// installed, since it would be rolled back.
+	if options.atomic && prepared.HadError() {
+		for _, dotfile := range prepared.Dotfiles {
+			if dotfile.PrepareError != nil {
+				color.New(color.FgRed).Printf("%s: %s\n", dotfile.DisplayPath(), dotfile.PrepareError)
+			}
 		}
 
-		installLogger := output.New(output.Config{
-			SourceConfig:    *sourceConfig,
-			InstallConfig:   installConfig,
-			PreparedInstall: prepared,
-			IsVerbose:       verbose,
-		})
+		return fmt.Errorf("some dotfiles failed to prepare, nothing was installed")
+	}
 
-		installConfig.EventLogger = installLogger.GetEventChan()
+	defer installLogger.LogEvents()()
 
-		installLogger.InstallInfo()
+	installed := installer.InstallDotfiles(prepared, installConfig)
 
-		if dryRun {
-			installLogger.DryrunInstall()
-			return nil
+	// Atomic installs leave every file, and the lockfile, unchanged when
+	// any dotfile fails to install.
+	if options.atomic && installed.HadError() {
+		if err := installer.RollbackInstall(installed, installConfig); err != nil {
+			return fmt.Errorf("some dotfiles failed to install, %s", err)
 		}
 
-		defer installLogger.LogEvents()()
+		return fmt.Errorf("some dotfiles failed to install, all changes were rolled back")
+	}
 
-		installed := installer.InstallDotfiles(prepared, installConfig)
-		executedScripts := installer.RunInstallScripts(prepared, installConfig)
-		finalizeErr := installer.FinalizeInstall(installed, installConfig)
+	executedScripts := installer.RunInstallScripts(prepared, installConfig)
+	finalizeErr := installer.FinalizeInstall(installed, installConfig)
 
-		if installed.HadError() {
-			return fmt.Errorf("some dotfiles failed to install")
+	// Each written lockfile is recorded as a generation which may later
+	// be rolled back to. Installs which failed are not worth returning to.
+	if finalizeErr == nil && !installed.HadError() {
+		_, finalizeErr = installer.RecordGeneration(prepared, installConfig)
+	}
+
+	if installed.HadError() {
+		return fmt.Errorf("some dotfiles failed to install")
+	}
+
+	if executedScripts.HadError() {
+		return fmt.Errorf("some dotfiles scripts had errors")
+	}
+
+	if finalizeErr != nil {
+		return fmt.Errorf("finalization error: %s", finalizeErr)
+	}
+
+	return reportConflicts(prepared, installConfig)
+}
+
+// conflictMode determines how locally modified dotfiles are handled from the
+// flags, of which only one may be given.
+func conflictMode(cmd *cobra.Command) (installer.ConflictMode, error) {
+	mode := installer.ConflictSkip
+
+	for _, flag := range []installer.ConflictMode{installer.ConflictForce, installer.ConflictBackup, installer.ConflictKeep} {
+		if set, _ := cmd.Flags().GetBool(string(flag)); !set {
+			continue
 		}
 
-		if executedScripts.HadError() {
-			return fmt.Errorf("some dotfiles scripts had errors")
+		if mode != installer.ConflictSkip {
+			return mode, fmt.Errorf("--%s and --%s may not be used together", mode, flag)
 		}
 
-		if finalizeErr != nil {
-			return fmt.Errorf("finalization error: %s", finalizeErr)
+		mode = flag
+	}
+
+	return mode, nil
+}
+
+// reportConflicts prints the dotfiles which need attention, those skipped as
+// they have been modified since they were last installed, and those merged
+// with conflict markers. Dotfiles which were merged cleanly are also noted,
+// as is the backup run to restore overwritten local versions from.
+func reportConflicts(install installer.PreparedInstall, config installer.InstallConfig) error {
+	skipped := 0
+	marked := 0
+	saved := 0
+
+	conflict := color.New(color.FgYellow)
+
+	for _, dotfile := range install.Dotfiles {
+		merged := installer.IsMerged(dotfile, config)
+
+		switch {
+		case merged && dotfile.Merge.Conflicts > 0:
+			conflict.Printf("conflict: %s merged with %d conflicts, resolve the conflict markers\n", dotfile.DisplayPath(), dotfile.Merge.Conflicts)
+			marked++
+		case merged:
+			color.New(color.FgCyan).Printf("merged: %s local modifications merged with changes to its sources\n", dotfile.DisplayPath())
+		case config.Conflicts == installer.ConflictBackup && dotfile.IsConflict():
+			saved++
+		case config.Conflicts != installer.ConflictSkip || !installer.IsSkippedConflict(dotfile, config):
+			continue
+		case dotfile.Merge != nil:
+			conflict.Printf("conflict: %s could not be merged with %d conflicts, skipped\n", dotfile.DisplayPath(), dotfile.Merge.Conflicts)
+			skipped++
+		default:
+			conflict.Printf("conflict: %s has been modified since it was last installed, skipped\n", dotfile.DisplayPath())
+			skipped++
 		}
+	}
+
+	if saved > 0 {
+		fmt.Printf("local versions of %d dotfiles saved, restore them with `dots restore --run %s`\n", saved, config.Backups.ID)
+	}
+
+	var err error
 
+	switch {
+	case skipped > 0:
+		err = fmt.Errorf("%d locally modified dotfiles were skipped, use --conflict-markers, --force, --backup or --keep", skipped)
+	case marked > 0:
+		err = fmt.Errorf("%d dotfiles were merged with conflicts", marked)
+	default:
 		return nil
-	},
-	Args: cobra.ArbitraryArgs,
+	}
+
+	return exitError{err: err, code: exitConflicts}
 }
 
 func init() {
@@ -77,4 +209,9 @@ func init() {
 	flags.BoolP("reinstall", "r", false, "forces execution of all installation scripts")
 	flags.BoolP("verbose", "v", false, "prints debug data")
 	flags.BoolP("dry-run", "n", false, "do not mutate any dotfiles, implies verbose")
+	flags.BoolP("atomic", "a", false, "roll back all changes if any dotfile fails to install")
+	flags.BoolP("force", "f", false, "overwrite dotfiles modified since they were last installed")
+	flags.BoolP("backup", "b", false, "overwrite modified dotfiles, saving the local version in the backup run")
+	flags.BoolP("keep", "k", false, "keep the local version of modified dotfiles for this install")
+	flags.BoolP("conflict-markers", "m", false, "install merges which conflict, marking the conflicting lines")
 }
@@ -19,6 +19,27 @@ var (
 	sourceLockfile *config.SourceLockfile
 )
 
+// Exit codes used for errors which are not failures of dots itself.
+const (
+	exitConflicts = 2
+	exitDrifted   = 3
+)
+
+// exitError is an error which exits dots with a specific exit code. Nothing
+// is printed when there is no underlying error.
+type exitError struct {
+	err  error
+	code int
+}
+
+func (e exitError) Error() string {
+	if e.err == nil {
+		return ""
+	}
+
+	return e.err.Error()
+}
+
 func loadConfigs(cmd *cobra.Command, args []string) error {
 	var err error
 
@@ -75,10 +96,24 @@ func main() {
 	rootCmd.AddCommand(&filesCmd)
 	rootCmd.AddCommand(&diffCmd)
 	rootCmd.AddCommand(&installCmd)
+	rootCmd.AddCommand(&statusCmd)
+	rootCmd.AddCommand(&adoptCmd)
+	rootCmd.AddCommand(&addCmd)
+	rootCmd.AddCommand(&editCmd)
+	rootCmd.AddCommand(&restoreCmd)
+	rootCmd.AddCommand(&generationsCmd)
+	rootCmd.AddCommand(&rollbackCmd)
 	rootCmd.AddCommand(&configCmd)
 
 	if err := rootCmd.Execute(); err != nil {
-		color.New(color.FgRed).Fprintf(os.Stderr, "error: %s\n", err)
+		if err.Error() != "" {
+			color.New(color.FgRed).Fprintf(os.Stderr, "error: %s\n", err)
+		}
+
+		if exitErr, ok := err.(exitError); ok {
+			os.Exit(exitErr.code)
+		}
+
 		os.Exit(1)
 	}
 }
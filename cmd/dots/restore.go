@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"go.evanpurkhiser.com/dots/installer"
+)
+
+var restoreCmd = cobra.Command{
+	Use:   "restore [path...]",
+	Short: "Restore files overwritten or removed by an install",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		run, _ := cmd.Flags().GetString("run")
+		list, _ := cmd.Flags().GetBool("list")
+
+		runs, err := installer.ListBackupRuns(sourceConfig)
+		if err != nil {
+			return err
+		}
+
+		if list {
+			return listBackupRuns(runs)
+		}
+
+		if run == "" && len(runs) == 0 {
+			return fmt.Errorf("no backups to restore")
+		}
+
+		if run == "" {
+			run = runs[len(runs)-1]
+		}
+
+		files, err := installer.BackupFiles(sourceConfig, run)
+		if err != nil {
+			return err
+		}
+
+		files = filterBackupFiles(files, args)
+
+		if len(files) == 0 {
+			return fmt.Errorf("no files in backup run %s match", run)
+		}
+
+		// Files being replaced are saved into a new backup run, so that the
+		// restore may itself be undone.
+		backups := installer.NewBackupRun(sourceConfig)
+		failed := false
+
+		for _, file := range files {
+			if err := installer.RestoreBackup(sourceConfig, run, file, backups); err != nil {
+				color.New(color.FgRed).Printf("%s: %s\n", file, err)
+				failed = true
+				continue
+			}
+
+			fmt.Printf("restored %s\n", file)
+		}
+
+		if failed {
+			return fmt.Errorf("some files failed to restore")
+		}
+
+		return nil
+	},
+}
+
+// listBackupRuns prints each backup run along with the files saved in it.
+func listBackupRuns(runs []string) error {
+	for _, run := range runs {
+		files, err := installer.BackupFiles(sourceConfig, run)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(run)
+
+		for _, file := range files {
+			color.New(color.FgHiBlack).Printf("  %s\n", file)
+		}
+	}
+
+	return nil
+}
+
+// filterBackupFiles filters the backed up files to those with one of the path
+// prefixes. Relative paths are relative to the install path, or the path of
+// any install target.
+func filterBackupFiles(files, paths []string) []string {
+	if len(paths) == 0 {
+		return files
+	}
+
+	roots := []string{sourceConfig.InstallPath}
+	for _, target := range sourceConfig.Targets {
+		roots = append(roots, target.Path)
+	}
+
+	prefixes := []string{}
+
+	for _, path := range paths {
+		if filepath.IsAbs(path) {
+			prefixes = append(prefixes, path)
+			continue
+		}
+
+		for _, root := range roots {
+			prefixes = append(prefixes, filepath.Join(root, path))
+		}
+	}
+
+	filtered := []string{}
+
+	for _, file := range files {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(file, prefix) {
+				filtered = append(filtered, file)
+				break
+			}
+		}
+	}
+
+	return filtered
+}
+
+func init() {
+	flags := restoreCmd.Flags()
+	flags.StringP("run", "r", "", "the backup run to restore from, defaults to the most recent run")
+	flags.BoolP("list", "l", false, "list backup runs and the files saved in each")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/installer"
+)
+
+var rollbackCmd = cobra.Command{
+	Use:   "rollback [generation]",
+	Short: "Reinstall a previous install generation",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		forceReInstall, _ := cmd.Flags().GetBool("reinstall")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		generation, err := rollbackGeneration(args)
+		if err != nil {
+			return err
+		}
+
+		installConfig := installer.InstallConfig{
+			SourceConfig:   sourceConfig,
+			SourceLockfile: sourceLockfile,
+			ForceReinstall: forceReInstall,
+			Backups:        installer.NewBackupRun(sourceConfig),
+		}
+
+		changes, err := installer.GenerationChanges(generation, installConfig)
+		if err != nil {
+			return err
+		}
+
+		if dryRun {
+			printGenerationChanges(changes)
+			return nil
+		}
+
+		installer.InstallGeneration(generation, changes, installConfig)
+		printGenerationChanges(changes)
+
+		for _, change := range changes {
+			if change.InstallError != nil {
+				return fmt.Errorf("some files failed to install, the lockfile was not updated")
+			}
+		}
+
+		scriptsErr := installer.RunGenerationScripts(generation, changes, installConfig)
+
+		if err := config.WriteLockfile(&generation.Lockfile, sourceConfig); err != nil {
+			return fmt.Errorf("finalization error: %s", err)
+		}
+
+		rollback, err := installer.RecordRollback(generation, installConfig)
+		if err != nil {
+			return fmt.Errorf("failed to record generation: %s", err)
+		}
+
+		fmt.Printf("rolled back to generation %d as generation %d\n", generation.Number, rollback.Number)
+
+		return scriptsErr
+	},
+	Args: cobra.MaximumNArgs(1),
+}
+
+// rollbackGeneration loads the generation given as an argument, or the
+// generation before the current one. When the latest generation is itself a
+// rollback, the generation before the one it reinstalled is used, so repeated
+// rollbacks step further back.
+func rollbackGeneration(args []string) (*installer.Generation, error) {
+	if len(args) == 1 {
+		number, err := strconv.Atoi(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a generation number", args[0])
+		}
+
+		return installer.LoadGeneration(sourceConfig, number)
+	}
+
+	generations, err := installer.ListGenerations(sourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(generations) == 0 {
+		return nil, fmt.Errorf("no generations have been recorded")
+	}
+
+	latest := generations[len(generations)-1]
+
+	current := latest.Number
+	if latest.RollbackOf != 0 {
+		current = latest.RollbackOf
+	}
+
+	for i := len(generations) - 1; i >= 0; i-- {
+		if generations[i].Number < current {
+			return generations[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no previous generation to rollback to")
+}
+
+// printGenerationChanges prints each file changed by reinstalling a
+// generation.
+func printGenerationChanges(changes []*installer.GenerationChange) {
+	for _, change := range changes {
+		action := "install"
+		if change.Removed {
+			action = "remove"
+		}
+
+		if change.InstallError != nil {
+			color.New(color.FgRed).Printf("%s %s: %s\n", action, change.Path, change.InstallError)
+			continue
+		}
+
+		fmt.Printf("%s %s\n", action, change.Path)
+	}
+}
+
+func init() {
+	flags := rollbackCmd.Flags()
+	flags.SortFlags = false
+
+	flags.BoolP("reinstall", "r", false, "forces execution of all installation scripts")
+	flags.BoolP("dry-run", "n", false, "only list the files which would be changed")
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+
+	"go.evanpurkhiser.com/dots/installer"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+// statusKinds lists the statuses of dotfiles which are not in sync, in the
+// order they are reported.
+var statusKinds = []installer.Status{
+	installer.StatusAdded,
+	installer.StatusModified,
+	installer.StatusRemoved,
+	installer.StatusMode,
+	installer.StatusError,
+}
+
+// statusReport describes the dotfiles which are not in sync.
+type statusReport struct {
+	InSync          bool                     `json:"in_sync"`
+	Pending         map[installer.Status]int `json:"pending"`
+	LocallyModified int                      `json:"locally_modified"`
+	Dotfiles        []statusDotfile          `json:"dotfiles"`
+	installedCount  int
+}
+
+// statusDotfile describes a single dotfile which is not in sync.
+type statusDotfile struct {
+	Path            string           `json:"path"`
+	Target          string           `json:"target,omitempty"`
+	Status          installer.Status `json:"status"`
+	LocallyModified bool             `json:"locally_modified,omitempty"`
+	OldMode         string           `json:"old_mode,omitempty"`
+	NewMode         string           `json:"new_mode,omitempty"`
+	Error           string           `json:"error,omitempty"`
+}
+
+var statusCmd = cobra.Command{
+	Use:   "status [filter...]",
+	Short: "Report dotfiles which are not in sync with their sources",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("output")
+
+		dotfiles := resolver.ResolveDotfiles(*sourceConfig, *sourceLockfile).Filter(args)
+		warnCollisions(dotfiles)
+
+		prepared := installer.PrepareDotfiles(dotfiles, *sourceConfig, *sourceLockfile)
+
+		report := newStatusReport(prepared)
+
+		switch format {
+		case "text":
+			printStatusText(report)
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+
+			if err := encoder.Encode(report); err != nil {
+				return err
+			}
+		case "prometheus":
+			printStatusPrometheus(report)
+		default:
+			return fmt.Errorf("%q is not a valid output format", format)
+		}
+
+		if report.Pending[installer.StatusError] > 0 {
+			return exitError{code: 1}
+		}
+
+		if !report.InSync {
+			return exitError{code: exitDrifted}
+		}
+
+		return nil
+	},
+	Args: cobra.ArbitraryArgs,
+}
+
+// newStatusReport determines the status of each prepared dotfile.
+func newStatusReport(install installer.PreparedInstall) statusReport {
+	report := statusReport{
+		InSync:   true,
+		Pending:  map[installer.Status]int{},
+		Dotfiles: []statusDotfile{},
+	}
+
+	for _, kind := range statusKinds {
+		report.Pending[kind] = 0
+	}
+
+	for _, dotfile := range install.Dotfiles {
+		status := dotfile.Status()
+
+		if status == installer.StatusInSync && !dotfile.LocallyModified {
+			report.installedCount++
+			continue
+		}
+
+		entry := statusDotfile{
+			Path:            dotfile.Path,
+			Target:          dotfile.InstallTarget,
+			Status:          status,
+			LocallyModified: dotfile.LocallyModified,
+		}
+
+		if dotfile.Permissions.IsChanged() && !dotfile.Removed {
+			entry.OldMode = fmt.Sprintf("%#o", int(dotfile.Permissions.Old))
+			entry.NewMode = fmt.Sprintf("%#o", int(dotfile.Permissions.New))
+		}
+
+		if dotfile.PrepareError != nil {
+			entry.Error = dotfile.PrepareError.Error()
+		}
+
+		// Locally modified dotfiles may still match their sources
+		if status != installer.StatusInSync {
+			report.Pending[status]++
+			report.InSync = false
+		}
+
+		if dotfile.LocallyModified {
+			report.LocallyModified++
+		}
+
+		report.Dotfiles = append(report.Dotfiles, entry)
+	}
+
+	return report
+}
+
+// printStatusText prints the status of each dotfile which is not in sync.
+func printStatusText(report statusReport) {
+	colors := map[installer.Status]*color.Color{
+		installer.StatusAdded:    color.New(color.FgHiGreen),
+		installer.StatusModified: color.New(color.FgBlue),
+		installer.StatusRemoved:  color.New(color.FgHiRed),
+		installer.StatusMode:     color.New(color.FgBlue),
+		installer.StatusError:    color.New(color.FgRed),
+		installer.StatusInSync:   color.New(color.FgHiBlack),
+	}
+
+	for _, dotfile := range report.Dotfiles {
+		path := dotfile.Path
+		if dotfile.Target != "" {
+			path = dotfile.Target + ":" + path
+		}
+
+		colors[dotfile.Status].Printf("%-9s ", dotfile.Status)
+		fmt.Print(path)
+
+		if dotfile.OldMode != "" {
+			color.New(color.FgHiBlack).Printf(" [%s → %s]", dotfile.OldMode, dotfile.NewMode)
+		}
+
+		if dotfile.LocallyModified {
+			color.New(color.FgHiMagenta).Print(" (modified locally)")
+		}
+
+		if dotfile.Error != "" {
+			color.New(color.FgRed).Printf(": %s", dotfile.Error)
+		}
+
+		fmt.Println()
+	}
+
+	if report.InSync {
+		fmt.Printf("in sync, %d dotfiles installed\n", report.installedCount)
+	}
+}
+
+// printStatusPrometheus prints the report in the format of the Prometheus
+// node exporter textfile collector.
+func printStatusPrometheus(report statusReport) {
+	inSync := 0
+	if report.InSync {
+		inSync = 1
+	}
+
+	fmt.Println("# HELP dots_in_sync Whether all dotfiles are in sync with their sources.")
+	fmt.Println("# TYPE dots_in_sync gauge")
+	fmt.Printf("dots_in_sync %d\n", inSync)
+
+	fmt.Println("# HELP dots_dotfiles_pending Number of dotfiles with pending changes, by kind.")
+	fmt.Println("# TYPE dots_dotfiles_pending gauge")
+
+	for _, kind := range statusKinds {
+		fmt.Printf("dots_dotfiles_pending{kind=%q} %d\n", kind, report.Pending[kind])
+	}
+
+	fmt.Println("# HELP dots_dotfiles_locally_modified Number of dotfiles modified since they were last installed.")
+	fmt.Println("# TYPE dots_dotfiles_locally_modified gauge")
+	fmt.Printf("dots_dotfiles_locally_modified %d\n", report.LocallyModified)
+
+	fmt.Println("# HELP dots_status_timestamp_seconds Time the status was last checked.")
+	fmt.Println("# TYPE dots_status_timestamp_seconds gauge")
+	fmt.Printf("dots_status_timestamp_seconds %d\n", time.Now().Unix())
+}
+
+func init() {
+	flags := statusCmd.Flags()
+	flags.StringP("output", "o", "text", "output format, one of text, json or prometheus")
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -30,6 +31,62 @@ func (p Profiles) Names() []string {
 	return names
 }
 
+// MergeStrategy specifies how the sources of a dotfile are combined.
+type MergeStrategy string
+
+// Available merge strategies. The structured strategies deep-merge the keys of
+// later sources into earlier sources.
+const (
+	MergeConcat MergeStrategy = "concat"
+	MergeJSON   MergeStrategy = "json"
+	MergeYAML   MergeStrategy = "yaml"
+	MergeTOML   MergeStrategy = "toml"
+	MergeINI    MergeStrategy = "ini"
+)
+
+// MergeStrategies is the list of all valid merge strategies.
+var MergeStrategies = []MergeStrategy{MergeConcat, MergeJSON, MergeYAML, MergeTOML, MergeINI}
+
+// SymlinkMode specifies how the targets of symlink sources are installed.
+type SymlinkMode string
+
+// Available symlink modes. Rewritten symlinks have relative targets pointing
+// at other dotfiles rewritten to point at the installed dotfile, and all other
+// relative targets made absolute into the source tree. Verbatim symlinks are
+// installed with their target unchanged.
+const (
+	SymlinksRewrite  SymlinkMode = "rewrite"
+	SymlinksVerbatim SymlinkMode = "verbatim"
+)
+
+// InstallMode specifies how dotfiles are installed.
+type InstallMode string
+
+// Available install modes. Copied dotfiles are written to the install path,
+// while linked dotfiles are installed as symlinks to their source file so that
+// changes to the installed dotfile are made to the source. Dotfiles that must
+// be compiled are always copied.
+const (
+	InstallCopy InstallMode = "copy"
+	InstallLink InstallMode = "link"
+)
+
+// InstallTarget specifies a location outside of the install path that
+// dotfiles may be installed into.
+type InstallTarget struct {
+	// Path is the directory dotfiles of the target are installed into.
+	Path string `yaml:"path"`
+
+	// Directory specifies a directory within each group whose contents are
+	// installed into the target, rather than the install path. For example, a
+	// directory of `home` installs `base/home/.bashrc` as `.bashrc` within the
+	// target path.
+	Directory string `yaml:"directory"`
+}
+
+// Variables specifies a mapping of user defined variable names to values.
+type Variables map[string]interface{}
+
 // SourceConfig specifies the structure of the source dotfile configuration.
 type SourceConfig struct {
 	// SourcePath specifies where the source configuration files live. If left
@@ -51,6 +108,19 @@ type SourceConfig struct {
 	// installation file.
 	InstallSuffix string `yaml:"install_suffix"`
 
+	// RemoveSuffix specifies the file suffix to mark a file as a whiteout. A
+	// whiteout removes the dotfile, or directory of dotfiles, it is named after
+	// from all groups lower in the cascade.
+	RemoveSuffix string `yaml:"remove_suffix"`
+
+	// PatchSuffix specifies the file suffix to mark a file as a unified diff
+	// which will be applied to the compiled sources lower in the cascade.
+	PatchSuffix string `yaml:"patch_suffix"`
+
+	// TemplateSuffix specifies the file suffix to mark a source file as a Go
+	// text/template which will be rendered when the dotfile is compiled.
+	TemplateSuffix string `yaml:"template_suffix"`
+
 	// Groups specifies the configuration groups provided in the source
 	// repository. These may be more than one directory level deep.
 	Groups []string `yaml:"groups"`
@@ -68,6 +138,111 @@ type SourceConfig struct {
 	// configuration is useful for config files that do not support environment
 	// variable expansion.
 	ExpandEnvironment []string `yaml:"expand_environment"`
+
+	// Templates specifies a list of install file paths that should have all of
+	// their sources rendered as Go text/templates. This is equivalent to naming
+	// each source file with the TemplateSuffix.
+	Templates []string `yaml:"templates"`
+
+	// PreserveWhitespace specifies a list of install file paths whose sources
+	// should be combined byte-for-byte. Whitespace is not trimmed, shebangs are
+	// not removed from later sources, and no trailing newline is added. This
+	// is useful for Makefiles and files without a final newline.
+	PreserveWhitespace []string `yaml:"preserve_whitespace"`
+
+	// Merge specifies a mapping of install file paths to the strategy used to
+	// combine their sources. When not specified the strategy is determined by
+	// the file extension, with unknown extensions being concatenated.
+	Merge map[string]MergeStrategy `yaml:"merge"`
+
+	// InstallMode specifies how dotfiles are installed. Defaults to copy.
+	InstallMode InstallMode `yaml:"install_mode"`
+
+	// Symlinks specifies how dotfiles with a single symlink source have the
+	// target of the symlink installed. Defaults to rewrite.
+	Symlinks SymlinkMode `yaml:"symlinks"`
+
+	// DirectoryMode specifies the octal permissions used to create the
+	// directories of installed dotfiles. Defaults to 0755.
+	DirectoryMode string `yaml:"directory_mode"`
+
+	// Targets is a mapping of names to install targets outside of the install
+	// path. Dotfiles are installed into a target by the target directory, or
+	// by a file rule.
+	Targets map[string]InstallTarget `yaml:"targets"`
+
+	// Links is a mapping of absolute link paths to the path of an installed
+	// dotfile, relative to the install path. Each link is installed as a
+	// symlink to the installed dotfile, and removed once no longer declared.
+	// This is useful for dotfiles that must also be found in the home
+	// directory.
+	Links map[string]string `yaml:"links"`
+
+	// GroupLinks is a mapping of group names to links. Links of active groups
+	// are merged on top of the top level links in the order the groups are
+	// resolved.
+	GroupLinks map[string]map[string]string `yaml:"group_links"`
+
+	// Files specifies a list of rules that set options for all dotfiles
+	// matching a glob pattern. Rules are applied in order, with later rules
+	// taking precedence over earlier rules and the per-path lists above.
+	Files []FileRule `yaml:"files"`
+
+	// Variables specifies user defined values made available to templates and
+	// environment expansion.
+	Variables Variables `yaml:"variables"`
+
+	// GroupVariables is a mapping of group names to variables. Variables of
+	// active groups are merged on top of the top level variables in the order
+	// the groups are resolved. Groups are configured as a plain list of names,
+	// which has no room for variables without breaking existing configs, so
+	// their variables are kept in this separate mapping.
+	GroupVariables map[string]Variables `yaml:"group_variables"`
+
+	// ProfileVariables is a mapping of profile names to variables. Variables of
+	// the active profile are merged last. As with GroupVariables, profiles map
+	// directly to their list of groups, so their variables are kept separately.
+	ProfileVariables map[string]Variables `yaml:"profile_variables"`
+}
+
+// DefaultDirectoryMode is the mode used to create directories for installed
+// dotfiles when no directory mode is configured.
+const DefaultDirectoryMode os.FileMode = 0755
+
+// DirectoryFileMode returns the mode used to create directories for installed
+// dotfiles.
+func (c SourceConfig) DirectoryFileMode() os.FileMode {
+	mode, err := parseFileMode(c.DirectoryMode)
+	if err != nil || mode == 0 {
+		return DefaultDirectoryMode
+	}
+
+	return mode
+}
+
+// TargetDirectory returns the name of the install target whose directory
+// contains the path, along with the path relative to the target directory.
+// The most specific directory is used when target directories are nested. The
+// empty default target is returned when the path is not within the directory
+// of any target.
+func (c SourceConfig) TargetDirectory(dotfilePath string) (string, string) {
+	name, directory := "", ""
+
+	for candidate, target := range c.Targets {
+		if target.Directory == "" || len(target.Directory) <= len(directory) {
+			continue
+		}
+
+		if strings.HasPrefix(dotfilePath, target.Directory+"/") {
+			name, directory = candidate, target.Directory
+		}
+	}
+
+	if name == "" {
+		return "", dotfilePath
+	}
+
+	return name, strings.TrimPrefix(dotfilePath, directory+"/")
 }
 
 // SourceLockfile specifies the structure of the lockfile that is installed
@@ -83,6 +258,87 @@ type SourceLockfile struct {
 
 	// InstalledFiles is the current list of installed configuration files
 	InstalledFiles []string `json:"installed_files"`
+
+	// InstalledTargets is a mapping of install target names to the files
+	// currently installed into the target.
+	InstalledTargets map[string]InstalledTarget `json:"installed_targets,omitempty"`
+
+	// InstalledLinks is the current list of installed links
+	InstalledLinks []string `json:"installed_links,omitempty"`
+
+	// InstalledState maps the absolute path of each installed file and link
+	// to the state it was last installed with.
+	InstalledState map[string]FileState `json:"installed_state,omitempty"`
+}
+
+// FileState records the state of an installed file, as written by dots, and
+// of the sources it was compiled from.
+type FileState struct {
+	// Hash is the sha256 of the installed file contents.
+	Hash string `json:"hash,omitempty"`
+
+	// Mode is the permissions of the installed file.
+	Mode os.FileMode `json:"mode,omitempty"`
+
+	// LinkTarget is the target of the installed file when it is a symlink.
+	LinkTarget string `json:"link_target,omitempty"`
+
+	// Sources maps the path of each source to the sha256 of its contents.
+	Sources map[string]string `json:"sources,omitempty"`
+
+	// Base is the sha256 of the dotfile compiled from the sources, when the
+	// installed file differs from it because local modifications were merged
+	// into the dotfile.
+	Base string `json:"base,omitempty"`
+}
+
+// BaseHash returns the sha256 of the dotfile compiled from the sources the
+// file was installed from. Local modifications are relative to the base.
+func (s FileState) BaseHash() string {
+	if s.Base != "" {
+		return s.Base
+	}
+
+	return s.Hash
+}
+
+// Matches reports if the installed file described by the state is the same
+// as the other state. Sources are not compared.
+func (s FileState) Matches(other FileState) bool {
+	return s.Hash == other.Hash && s.Mode == other.Mode && s.LinkTarget == other.LinkTarget
+}
+
+// InstalledTarget records the files installed into an install target, along
+// with the path they were installed to.
+type InstalledTarget struct {
+	Path  string   `json:"path"`
+	Files []string `json:"files"`
+}
+
+// InstalledPaths returns the list of files currently installed into the named
+// target. The empty target name is the install path.
+func (l *SourceLockfile) InstalledPaths(target string) []string {
+	if target == "" {
+		return l.InstalledFiles
+	}
+
+	return l.InstalledTargets[target].Files
+}
+
+// TargetPath returns the directory dotfiles of the named target are installed
+// into. The empty target name is the install path. Targets which are no longer
+// configured resolve to the path they were last installed to, so that their
+// dotfiles may still be removed.
+func (l *SourceLockfile) TargetPath(config SourceConfig, target string) string {
+	if target == "" {
+		return config.InstallPath
+	}
+
+	if installTarget, ok := config.Targets[target]; ok {
+		return installTarget.Path
+	}
+
+	return l.InstalledTargets[target].Path
 }
 
 // ResolveGroups returns the list of groups the lockfile is currently locked to.
@@ -129,6 +385,17 @@ func LoadSourceConfig(configPath string) (*SourceConfig, error) {
 	config.InstallPath = os.ExpandEnv(config.InstallPath)
 	config.LockfilePath = os.ExpandEnv(config.LockfilePath)
 
+	for name, target := range config.Targets {
+		target.Path = os.ExpandEnv(target.Path)
+		config.Targets[name] = target
+	}
+
+	config.Links = expandLinks(config.Links)
+
+	for group, links := range config.GroupLinks {
+		config.GroupLinks[group] = expandLinks(links)
+	}
+
 	// Determine the lockfile path if not configured
 	if config.LockfilePath == "" {
 		config.LockfilePath = path.Join(config.InstallPath, "dots", "dotlock.json")
@@ -137,6 +404,39 @@ func LoadSourceConfig(configPath string) (*SourceConfig, error) {
 	return config, nil
 }
 
+// expandLinks resolves environment variables in the paths of links.
+func expandLinks(links map[string]string) map[string]string {
+	if links == nil {
+		return nil
+	}
+
+	expanded := make(map[string]string, len(links))
+
+	for link, dotfile := range links {
+		expanded[os.ExpandEnv(link)] = dotfile
+	}
+
+	return expanded
+}
+
+// ResolveLinks returns the links declared for the groups, mapping the link
+// path to the dotfile path it links to. Links of later groups take precedence.
+func (c SourceConfig) ResolveLinks(groups []string) map[string]string {
+	links := map[string]string{}
+
+	for link, dotfile := range c.Links {
+		links[link] = dotfile
+	}
+
+	for _, group := range groups {
+		for link, dotfile := range c.GroupLinks[group] {
+			links[link] = dotfile
+		}
+	}
+
+	return links
+}
+
 // LoadLockfile reads and unmarshals the json lockfile into a SourceLockfile.
 func LoadLockfile(config *SourceConfig) (*SourceLockfile, error) {
 	lockfile := &SourceLockfile{}
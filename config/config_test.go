@@ -0,0 +1,97 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTargetDirectory(t *testing.T) {
+	config := SourceConfig{
+		Targets: map[string]InstallTarget{
+			"home":  {Path: "/home", Directory: "home"},
+			"bin":   {Path: "/home/.local/bin", Directory: "home/bin"},
+			"other": {Path: "/other"},
+		},
+	}
+
+	testCases := []struct {
+		path           string
+		expectedTarget string
+		expectedPath   string
+	}{
+		{"git/config", "", "git/config"},
+		{"home/.bashrc", "home", ".bashrc"},
+		{"home/bin/backup", "bin", "backup"},
+		{"homework/notes", "", "homework/notes"},
+	}
+
+	for _, testCase := range testCases {
+		target, path := config.TargetDirectory(testCase.path)
+
+		if target != testCase.expectedTarget || path != testCase.expectedPath {
+			t.Errorf(
+				"Expected = %q, %q; got = %q, %q",
+				testCase.expectedTarget,
+				testCase.expectedPath,
+				target,
+				path,
+			)
+		}
+	}
+}
+
+func TestLockfileTargetPath(t *testing.T) {
+	config := SourceConfig{
+		InstallPath: "/home/.config",
+		Targets: map[string]InstallTarget{
+			"home": {Path: "/home"},
+		},
+	}
+
+	lockfile := SourceLockfile{
+		InstalledTargets: map[string]InstalledTarget{
+			"home": {Path: "/old-home"},
+			"gone": {Path: "/opt"},
+		},
+	}
+
+	testCases := []struct {
+		target   string
+		expected string
+	}{
+		{"", "/home/.config"},
+		{"home", "/home"},
+		{"gone", "/opt"},
+		{"unknown", ""},
+	}
+
+	for _, testCase := range testCases {
+		if actual := lockfile.TargetPath(config, testCase.target); actual != testCase.expected {
+			t.Errorf("Expected = %q; got = %q", testCase.expected, actual)
+		}
+	}
+}
+
+func TestResolveLinks(t *testing.T) {
+	config := SourceConfig{
+		Links: map[string]string{
+			"/home/.bashrc":    "bash/bashrc",
+			"/home/.gitconfig": "git/config",
+		},
+		GroupLinks: map[string]map[string]string{
+			"machines/desktop": {"/home/.gitconfig": "git/config-desktop"},
+			"machines/laptop":  {"/home/.laptop": "laptop"},
+		},
+	}
+
+	expected := map[string]string{
+		"/home/.bashrc":    "bash/bashrc",
+		"/home/.gitconfig": "git/config-desktop",
+	}
+
+	links := config.ResolveLinks([]string{"base", "machines/desktop"})
+
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("Expected = %v; got = %v", expected, links)
+	}
+}
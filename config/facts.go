@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// hostnameGetter retrieves the hostname of the current machine.
+var hostnameGetter = os.Hostname
+
+// Facts describes the machine dotfiles are being installed onto, along with
+// the profile and groups the machine has been configured with.
+type Facts struct {
+	Hostname string
+	OS       string
+	Arch     string
+	Profile  string
+	Groups   []string
+}
+
+// ResolveFacts collects the facts about the current machine and the profile
+// and groups the lockfile is locked to.
+func (l *SourceLockfile) ResolveFacts(config SourceConfig) Facts {
+	hostname, _ := hostnameGetter()
+
+	return Facts{
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		Profile:  l.Profile,
+		Groups:   l.ResolveGroups(config),
+	}
+}
+
+// Match reports if the fact of the given kind matches any of the values. The
+// group kind matches if any of the values is an active group. An error is
+// returned for unknown kinds of facts.
+func (f Facts) Match(kind string, values []string) (bool, error) {
+	var facts []string
+
+	switch kind {
+	case "group":
+		facts = f.Groups
+	case "profile":
+		facts = []string{f.Profile}
+	case "os":
+		facts = []string{f.OS}
+	case "arch":
+		facts = []string{f.Arch}
+	case "hostname":
+		facts = []string{f.Hostname}
+	default:
+		return false, fmt.Errorf("unknown condition %q", kind)
+	}
+
+	return len(listIntersect(values, facts)) > 0, nil
+}
+
+// MatchCondition reports if a condition of the form `[not] <kind> <value...>`
+// matches the facts. An error is returned for malformed conditions.
+func (f Facts) MatchCondition(condition string) (bool, error) {
+	fields := strings.Fields(condition)
+
+	negate := len(fields) > 0 && fields[0] == "not"
+	if negate {
+		fields = fields[1:]
+	}
+
+	if len(fields) < 2 {
+		return false, fmt.Errorf("expected condition of the form `[not] <kind> <value...>`")
+	}
+
+	matched, err := f.Match(fields[0], fields[1:])
+	if err != nil {
+		return false, err
+	}
+
+	return matched != negate, nil
+}
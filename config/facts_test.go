@@ -0,0 +1,76 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestFactsMatch(t *testing.T) {
+	facts := Facts{
+		Hostname: "desktop",
+		OS:       "linux",
+		Arch:     "amd64",
+		Profile:  "home",
+		Groups:   []string{"base", "machines/desktop"},
+	}
+
+	testCases := []struct {
+		kind     string
+		values   []string
+		expected bool
+	}{
+		{"group", []string{"machines/desktop"}, true},
+		{"group", []string{"machines/server"}, false},
+		{"group", []string{"machines/server", "base"}, true},
+		{"profile", []string{"home"}, true},
+		{"os", []string{"darwin"}, false},
+		{"os", []string{"darwin", "linux"}, true},
+		{"arch", []string{"amd64"}, true},
+		{"hostname", []string{"laptop"}, false},
+	}
+
+	for _, testCase := range testCases {
+		matched, err := facts.Match(testCase.kind, testCase.values)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+
+		if matched != testCase.expected {
+			t.Errorf("Expected %s %v matched = %t", testCase.kind, testCase.values, testCase.expected)
+		}
+	}
+
+	if _, err := facts.Match("color", []string{"blue"}); err == nil {
+		t.Errorf("Expected error for unknown condition")
+	}
+}
+
+func TestFactsMatchCondition(t *testing.T) {
+	facts := Facts{OS: "linux", Groups: []string{"base"}}
+
+	testCases := []struct {
+		condition string
+		expected  bool
+	}{
+		{"os linux", true},
+		{"not os linux", false},
+		{"not group machines/server", true},
+		{"group machines/server base", true},
+	}
+
+	for _, testCase := range testCases {
+		matched, err := facts.MatchCondition(testCase.condition)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+
+		if matched != testCase.expected {
+			t.Errorf("Expected %q matched = %t", testCase.condition, testCase.expected)
+		}
+	}
+
+	for _, condition := range []string{"", "not", "os", "color blue"} {
+		if _, err := facts.MatchCondition(condition); err == nil {
+			t.Errorf("Expected error for condition %q", condition)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// FileRule specifies options for all dotfiles matching the rule pattern.
+// Options which are not specified leave the dotfile unchanged, allowing
+// later rules to refine earlier rules.
+type FileRule struct {
+	// Match is a glob pattern matched against the path of dotfiles. `*` and
+	// `?` do not match path separators, while `**` matches any number of
+	// directories. Patterns without a separator match the file name of
+	// dotfiles at any depth.
+	Match string `yaml:"match"`
+
+	// When is a list of conditions of the form `[not] <kind> <value...>` that
+	// must all match for the rule to be applied.
+	When []string `yaml:"when"`
+
+	// Mode specifies the octal permissions the dotfile is installed with.
+	Mode string `yaml:"mode"`
+
+	// DirectoryMode specifies the octal permissions of the directories
+	// matching the rule pattern which contain dotfiles.
+	DirectoryMode string `yaml:"directory_mode"`
+
+	// ExpandEnvironment specifies if environment variables are expanded.
+	ExpandEnvironment *bool `yaml:"expand_environment"`
+
+	// Template specifies if sources are rendered as Go text/templates.
+	Template *bool `yaml:"template"`
+
+	// PreserveWhitespace specifies if sources are combined byte-for-byte.
+	PreserveWhitespace *bool `yaml:"preserve_whitespace"`
+
+	// Merge specifies the strategy used to combine the sources.
+	Merge MergeStrategy `yaml:"merge"`
+
+	// InstallMode specifies how the dotfile is installed.
+	InstallMode InstallMode `yaml:"install_mode"`
+
+	// Target specifies the path, relative to the install path, that the
+	// dotfile is installed to. A target ending in a separator is a directory
+	// the dotfile is installed into, keeping its file name.
+	Target string `yaml:"target"`
+
+	// InstallTarget specifies the name of the install target the dotfile is
+	// installed into. The dotfile keeps its path, or the rule target, within
+	// the install target.
+	InstallTarget string `yaml:"install_target"`
+}
+
+// Matches reports if the dotfile path matches the rule pattern.
+func (r FileRule) Matches(dotfilePath string) bool {
+	return MatchPattern(r.Match, dotfilePath)
+}
+
+// MatchPattern reports if the path matches the glob pattern, in the same way
+// as the pattern of a file rule.
+func MatchPattern(pattern, filePath string) bool {
+	if !strings.Contains(pattern, "/") {
+		filePath = path.Base(filePath)
+	}
+
+	return matchGlob(strings.Split(pattern, "/"), strings.Split(filePath, "/"))
+}
+
+// MatchesFacts reports if all conditions of the rule match the facts.
+func (r FileRule) MatchesFacts(facts Facts) (bool, error) {
+	for _, condition := range r.When {
+		matched, err := facts.MatchCondition(condition)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// FileMode parses the mode of the rule. Zero is returned when the rule does
+// not specify a mode.
+func (r FileRule) FileMode() (os.FileMode, error) {
+	return parseFileMode(r.Mode)
+}
+
+// DirectoryFileMode parses the directory mode of the rule. Zero is returned
+// when the rule does not specify a directory mode.
+func (r FileRule) DirectoryFileMode() (os.FileMode, error) {
+	return parseFileMode(r.DirectoryMode)
+}
+
+// parseFileMode parses octal permissions. Zero is returned for an empty mode.
+func parseFileMode(mode string) (os.FileMode, error) {
+	if mode == "" {
+		return 0, nil
+	}
+
+	parsed, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || parsed == 0 || os.FileMode(parsed)&^os.ModePerm != 0 {
+		return 0, fmt.Errorf("%q is not a valid octal file mode", mode)
+	}
+
+	return os.FileMode(parsed), nil
+}
+
+// TargetPath returns the path the dotfile will be installed to given the rule
+// target.
+func (r FileRule) TargetPath(dotfilePath string) string {
+	if strings.HasSuffix(r.Target, "/") {
+		return path.Join(r.Target, path.Base(dotfilePath))
+	}
+
+	return path.Clean(r.Target)
+}
+
+// matchGlob matches the path segments against the pattern segments. A `**`
+// pattern segment matches zero or more path segments.
+func matchGlob(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchGlob(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(segments) == 0 {
+		return false
+	}
+
+	if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+		return false
+	}
+
+	return matchGlob(pattern[1:], segments[1:])
+}
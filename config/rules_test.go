@@ -0,0 +1,112 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFileRuleMatches(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"bashrc", "bashrc", true},
+		{"bashrc", "bash/bashrc", true},
+		{"*.sh", "bin/scripts/run.sh", true},
+		{"*.sh", "run.bash", false},
+		{"ssh/*", "ssh/config", true},
+		{"ssh/*", "ssh/keys/id_rsa", false},
+		{"ssh/**", "ssh/keys/id_rsa", true},
+		{"ssh/**", "ssh", true},
+		{"**/config", "git/config", true},
+		{"**/config", "config", true},
+		{"**/config", "git/config/extra", false},
+		{"bin/**/*.sh", "bin/a/b/run.sh", true},
+		{"bin/**/*.sh", "bin/run.sh", true},
+		{"bin/**/*.sh", "lib/run.sh", false},
+		{"vim/?imrc", "vim/vimrc", true},
+	}
+
+	for _, testCase := range testCases {
+		rule := FileRule{Match: testCase.pattern}
+
+		if actual := rule.Matches(testCase.path); actual != testCase.expected {
+			t.Errorf("Expected %q matching %q = %t", testCase.pattern, testCase.path, testCase.expected)
+		}
+	}
+}
+
+func TestFileRuleMatchesFacts(t *testing.T) {
+	facts := Facts{OS: "linux", Groups: []string{"base"}}
+
+	testCases := []struct {
+		when     []string
+		expected bool
+	}{
+		{nil, true},
+		{[]string{"os linux"}, true},
+		{[]string{"os linux", "group base"}, true},
+		{[]string{"os linux", "not group base"}, false},
+	}
+
+	for _, testCase := range testCases {
+		rule := FileRule{Match: "*", When: testCase.when}
+
+		matched, err := rule.MatchesFacts(facts)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+
+		if matched != testCase.expected {
+			t.Errorf("Expected %v matched = %t", testCase.when, testCase.expected)
+		}
+	}
+}
+
+func TestFileRuleFileMode(t *testing.T) {
+	testCases := []struct {
+		mode     string
+		expected os.FileMode
+		valid    bool
+	}{
+		{"", 0, true},
+		{"0600", 0600, true},
+		{"755", 0755, true},
+		{"0", 0, false},
+		{"0800", 0, false},
+		{"10000", 0, false},
+	}
+
+	for _, testCase := range testCases {
+		mode, err := FileRule{Mode: testCase.mode}.FileMode()
+
+		if (err == nil) != testCase.valid {
+			t.Errorf("Expected mode %q valid = %t; got error = %v", testCase.mode, testCase.valid, err)
+		}
+
+		if mode != testCase.expected {
+			t.Errorf("Expected mode %q = %o; got = %o", testCase.mode, testCase.expected, mode)
+		}
+	}
+}
+
+func TestFileRuleTargetPath(t *testing.T) {
+	testCases := []struct {
+		target   string
+		path     string
+		expected string
+	}{
+		{"bash/bashrc", "bashrc", "bash/bashrc"},
+		{"bin/", "scripts/run.sh", "bin/run.sh"},
+		{"./bin//run", "run.sh", "bin/run"},
+	}
+
+	for _, testCase := range testCases {
+		rule := FileRule{Target: testCase.target}
+
+		if actual := rule.TargetPath(testCase.path); actual != testCase.expected {
+			t.Errorf("Expected = %q; got = %q", testCase.expected, actual)
+		}
+	}
+}
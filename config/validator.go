@@ -3,7 +3,10 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
 // SanitizeSourceConfig validates and sanitizes a SourceConfig object, ensuring
@@ -25,8 +28,30 @@ import (
 //
 //  8. All profiles do not specify groups that are already configured as base groups.
 //
+//  9. Group variables are only specified for configured groups.
+//
+//  10. Profile variables are only specified for configured profiles.
+//
+//  11. Merge strategies are valid strategies.
+//
+//  12. Install targets have a path and a unique relative directory.
+//
+//  13. File rules have valid patterns, conditions, modes, merge strategies,
+//     relative targets and configured install targets.
+//
+//  14. The directory mode is a valid octal file mode.
+//
+//  15. The symlink mode is a valid symlink mode.
+//
+//  16. The install mode is a valid install mode.
+//
+//  17. Links have absolute paths and link to relative dotfile paths. Group
+//     links are only specified for configured groups.
+//
 // Any groups that do not meet these conditions will be removed from the group
-// list being sanitized.
+// list being sanitized. Variables and links for unknown groups or profiles,
+// invalid merge strategies, invalid install targets, invalid file rules,
+// invalid links and invalid directory, symlink and install modes are removed.
 func SanitizeSourceConfig(config *SourceConfig) []error {
 	errs := []error{}
 
@@ -128,9 +153,259 @@ func SanitizeSourceConfig(config *SourceConfig) []error {
 		config.Profiles[profile] = listDifference(groups, missingGroups)
 	}
 
+	// 9. Group variables must be for configured groups
+	for group := range config.GroupVariables {
+		if len(listIntersect([]string{group}, config.Groups)) > 0 {
+			continue
+		}
+
+		// Missing groups have already been reported
+		if len(listIntersect([]string{group}, missingGroups)) == 0 {
+			errs = append(errs, fmt.Errorf("group_variables: group %q is not a valid group", group))
+		}
+
+		delete(config.GroupVariables, group)
+	}
+
+	// 10. Profile variables must be for configured profiles
+	for profile := range config.ProfileVariables {
+		if _, ok := config.Profiles[profile]; ok {
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("profile_variables: profile %q is not a configured profile", profile))
+		delete(config.ProfileVariables, profile)
+	}
+
+	// 11. Merge strategies must be valid
+	for path, strategy := range config.Merge {
+		if isValidStrategy(strategy) {
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("merge: %q is not a valid strategy for %q", strategy, path))
+		delete(config.Merge, path)
+	}
+
+	// 12. Install targets must be valid
+	targetDirectories := map[string]string{}
+
+	for _, name := range sortedTargets(config.Targets) {
+		target := config.Targets[name]
+
+		if err := validateInstallTarget(target, targetDirectories); err != nil {
+			errs = append(errs, fmt.Errorf("targets: %q: %s", name, err))
+			delete(config.Targets, name)
+			continue
+		}
+
+		target.Path = filepath.Clean(target.Path)
+
+		if target.Directory != "" {
+			target.Directory = path.Clean(target.Directory)
+			targetDirectories[target.Directory] = name
+		}
+
+		config.Targets[name] = target
+	}
+
+	// 13. File rules must be valid
+	rules := make([]FileRule, 0, len(config.Files))
+
+	for i, rule := range config.Files {
+		if err := validateFileRule(rule, config.Targets); err != nil {
+			errs = append(errs, fmt.Errorf("files: rule #%d: %s", i+1, err))
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	config.Files = rules
+
+	// 14. Directory mode must be valid
+	if _, err := parseFileMode(config.DirectoryMode); err != nil {
+		errs = append(errs, fmt.Errorf("directory_mode: %s", err))
+		config.DirectoryMode = ""
+	}
+
+	// 15. Symlink mode must be valid
+	switch config.Symlinks {
+	case "", SymlinksRewrite, SymlinksVerbatim:
+	default:
+		errs = append(errs, fmt.Errorf("symlinks: %q is not a valid symlink mode", config.Symlinks))
+		config.Symlinks = ""
+	}
+
+	// 16. Install mode must be valid
+	if !isValidInstallMode(config.InstallMode) {
+		errs = append(errs, fmt.Errorf("install_mode: %q is not a valid install mode", config.InstallMode))
+		config.InstallMode = ""
+	}
+
+	// 17. Links must be valid
+	errs = append(errs, sanitizeLinks("links", config.Links)...)
+
+	for group, links := range config.GroupLinks {
+		if len(listIntersect([]string{group}, config.Groups)) == 0 {
+			if len(listIntersect([]string{group}, missingGroups)) == 0 {
+				errs = append(errs, fmt.Errorf("group_links: group %q is not a valid group", group))
+			}
+
+			delete(config.GroupLinks, group)
+			continue
+		}
+
+		errs = append(errs, sanitizeLinks(fmt.Sprintf("group_links: %q", group), links)...)
+	}
+
+	return errs
+}
+
+// sanitizeLinks removes links which do not have an absolute path, or which do
+// not link to a relative dotfile path. Errors are prefixed with the name of the
+// links being sanitized.
+func sanitizeLinks(name string, links map[string]string) []error {
+	errs := []error{}
+
+	for _, link := range sortedKeys(links) {
+		dotfile := links[link]
+
+		var err error
+
+		switch dotfilePath := path.Clean(dotfile); {
+		case !filepath.IsAbs(link):
+			err = fmt.Errorf("%s: link %q must be an absolute path", name, link)
+		case dotfile == "" || path.IsAbs(dotfile) || dotfilePath == "." || strings.HasPrefix(dotfilePath, ".."):
+			err = fmt.Errorf("%s: %q must link to a dotfile relative to the install path", name, link)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+			delete(links, link)
+			continue
+		}
+
+		delete(links, link)
+		links[filepath.Clean(link)] = path.Clean(dotfile)
+	}
+
 	return errs
 }
 
+func isValidStrategy(strategy MergeStrategy) bool {
+	for _, validStrategy := range MergeStrategies {
+		if strategy == validStrategy {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isValidInstallMode(mode InstallMode) bool {
+	return mode == "" || mode == InstallCopy || mode == InstallLink
+}
+
+// sortedTargets returns the names of the install targets in order, so that
+// targets are validated consistently.
+func sortedTargets(targets map[string]InstallTarget) []string {
+	names := make([]string, 0, len(targets))
+
+	for name := range targets {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// sortedKeys returns the keys of the mapping in order, so that they are
+// validated consistently.
+func sortedKeys(mapping map[string]string) []string {
+	keys := make([]string, 0, len(mapping))
+
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// validateInstallTarget checks that the install target has a path, and that
+// its directory is relative and not already used by another target.
+func validateInstallTarget(target InstallTarget, directories map[string]string) error {
+	if target.Path == "" {
+		return fmt.Errorf("path must be specified")
+	}
+
+	if target.Directory == "" {
+		return nil
+	}
+
+	directory := path.Clean(target.Directory)
+
+	if path.IsAbs(directory) || directory == "." || strings.HasPrefix(directory, "..") {
+		return fmt.Errorf("directory: %q must be relative to the groups", target.Directory)
+	}
+
+	if other, ok := directories[directory]; ok {
+		return fmt.Errorf("directory: %q is already used by target %q", target.Directory, other)
+	}
+
+	return nil
+}
+
+// validateFileRule checks that all options of a file rule are valid.
+func validateFileRule(rule FileRule, targets map[string]InstallTarget) error {
+	if rule.Match == "" {
+		return fmt.Errorf("match pattern must be specified")
+	}
+
+	if _, err := path.Match(rule.Match, ""); err != nil {
+		return fmt.Errorf("match: %q is not a valid pattern", rule.Match)
+	}
+
+	for _, condition := range rule.When {
+		if _, err := (Facts{}).MatchCondition(condition); err != nil {
+			return fmt.Errorf("when: %q: %s", condition, err)
+		}
+	}
+
+	if _, err := rule.FileMode(); err != nil {
+		return fmt.Errorf("mode: %s", err)
+	}
+
+	if _, err := rule.DirectoryFileMode(); err != nil {
+		return fmt.Errorf("directory_mode: %s", err)
+	}
+
+	if rule.Merge != "" && !isValidStrategy(rule.Merge) {
+		return fmt.Errorf("merge: %q is not a valid strategy", rule.Merge)
+	}
+
+	if !isValidInstallMode(rule.InstallMode) {
+		return fmt.Errorf("install_mode: %q is not a valid install mode", rule.InstallMode)
+	}
+
+	if rule.Target != "" {
+		target := rule.TargetPath(rule.Match)
+
+		if path.IsAbs(rule.Target) || target == "." || strings.HasPrefix(target, "..") {
+			return fmt.Errorf("target: %q must be relative to the install path", rule.Target)
+		}
+	}
+
+	if _, ok := targets[rule.InstallTarget]; rule.InstallTarget != "" && !ok {
+		return fmt.Errorf("install_target: %q is not a configured target", rule.InstallTarget)
+	}
+
+	return nil
+}
+
 // ValidateLockfile validates the lockfile with the following conditions:
 //
 // If a profile is specified:
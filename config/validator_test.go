@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -359,3 +360,264 @@ func TestLockfileContainsBaseGroups(t *testing.T) {
 		t.Errorf("Expected invalid lockfile due to included base groups; got err = %q", err)
 	}
 }
+
+// TestInvalidVariableGroupsAndProfiles tests that variables specified for
+// groups or profiles that do not exist are removed.
+func TestInvalidVariableGroupsAndProfiles(t *testing.T) {
+	config := &SourceConfig{
+		SourcePath: tmpPath,
+		Groups:     []string{"group1"},
+		Profiles: Profiles{
+			"test-profile": []string{"group1"},
+		},
+		GroupVariables: map[string]Variables{
+			"group1": {"one": 1},
+			"group2": {"two": 2},
+		},
+		ProfileVariables: map[string]Variables{
+			"test-profile":  {"one": 1},
+			"test-profile2": {"two": 2},
+		},
+	}
+
+	groupPath := filepath.Join(tmpPath, "group1")
+
+	os.Mkdir(groupPath, 0755)
+	defer os.Remove(groupPath)
+
+	errs := SanitizeSourceConfig(config)
+
+	if len(errs) != 2 {
+		t.Fatalf("Expected len(errs) = 2; got %d", len(errs))
+	}
+
+	if errs[0].Error() != "group_variables: group \"group2\" is not a valid group" {
+		t.Errorf("Expected invalid group error; got = %q", errs[0])
+	}
+
+	if errs[1].Error() != "profile_variables: profile \"test-profile2\" is not a configured profile" {
+		t.Errorf("Expected invalid profile error; got = %q", errs[1])
+	}
+
+	if len(config.GroupVariables) != 1 {
+		t.Errorf("Expected invalid group to be removed from group variables")
+	}
+
+	if len(config.ProfileVariables) != 1 {
+		t.Errorf("Expected invalid profile to be removed from profile variables")
+	}
+}
+
+// TestInvalidMergeStrategy tests that invalid merge strategies are removed.
+func TestInvalidMergeStrategy(t *testing.T) {
+	config := &SourceConfig{
+		SourcePath: tmpPath,
+		Merge: map[string]MergeStrategy{
+			"settings.json": MergeJSON,
+			"other.conf":    "xml",
+		},
+	}
+
+	errs := SanitizeSourceConfig(config)
+
+	if len(errs) != 1 {
+		t.Fatalf("Expected len(errs) = 1; got %d", len(errs))
+	}
+
+	if errs[0].Error() != "merge: \"xml\" is not a valid strategy for \"other.conf\"" {
+		t.Errorf("Expected invalid strategy error; got = %q", errs[0])
+	}
+
+	if len(config.Merge) != 1 {
+		t.Errorf("Expected invalid strategy to be removed")
+	}
+}
+
+// TestInvalidFileRules tests that invalid file rules are removed.
+func TestInvalidFileRules(t *testing.T) {
+	config := &SourceConfig{
+		SourcePath: tmpPath,
+		Files: []FileRule{
+			{Match: "ssh/*", Mode: "0600"},
+			{Match: ""},
+			{Match: "[", Mode: "0600"},
+			{Match: "*.sh", When: []string{"color blue"}},
+			{Match: "*.sh", Mode: "999"},
+			{Match: "*.sh", Merge: "xml"},
+			{Match: "*.sh", Target: "../bin/"},
+			{Match: "ssh", DirectoryMode: "0"},
+			{Match: "ssh", InstallMode: "hardlink"},
+		},
+	}
+
+	errs := SanitizeSourceConfig(config)
+
+	expected := []string{
+		"files: rule #2: match pattern must be specified",
+		"files: rule #3: match: \"[\" is not a valid pattern",
+		"files: rule #4: when: \"color blue\": unknown condition \"color\"",
+		"files: rule #5: mode: \"999\" is not a valid octal file mode",
+		"files: rule #6: merge: \"xml\" is not a valid strategy",
+		"files: rule #7: target: \"../bin/\" must be relative to the install path",
+		"files: rule #8: directory_mode: \"0\" is not a valid octal file mode",
+		"files: rule #9: install_mode: \"hardlink\" is not a valid install mode",
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected len(errs) = %d; got %d: %v", len(expected), len(errs), errs)
+	}
+
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("Expected error = %q; got = %q", expected[i], err)
+		}
+	}
+
+	if len(config.Files) != 1 || config.Files[0].Match != "ssh/*" {
+		t.Errorf("Expected invalid file rules to be removed")
+	}
+}
+
+// TestInvalidDirectoryMode tests that an invalid directory mode is removed.
+func TestInvalidInstallTargets(t *testing.T) {
+	config := &SourceConfig{
+		SourcePath: tmpPath,
+		Targets: map[string]InstallTarget{
+			"bin":      {Path: "/home/.local/bin/"},
+			"home":     {Path: "/home", Directory: "home/"},
+			"nopath":   {Directory: "nopath"},
+			"outside":  {Path: "/opt", Directory: "../opt"},
+			"reusedir": {Path: "/srv", Directory: "home"},
+		},
+		Files: []FileRule{
+			{Match: "bin/*", InstallTarget: "bin"},
+			{Match: "opt/*", InstallTarget: "outside"},
+		},
+	}
+
+	errs := SanitizeSourceConfig(config)
+
+	expected := []string{
+		"targets: \"nopath\": path must be specified",
+		"targets: \"outside\": directory: \"../opt\" must be relative to the groups",
+		"targets: \"reusedir\": directory: \"home\" is already used by target \"home\"",
+		"files: rule #2: install_target: \"outside\" is not a configured target",
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected len(errs) = %d; got %d: %v", len(expected), len(errs), errs)
+	}
+
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("Expected error = %q; got = %q", expected[i], err)
+		}
+	}
+
+	expectedTargets := map[string]InstallTarget{
+		"bin":  {Path: "/home/.local/bin"},
+		"home": {Path: "/home", Directory: "home"},
+	}
+
+	if !reflect.DeepEqual(config.Targets, expectedTargets) {
+		t.Errorf("Expected targets = %v; got = %v", expectedTargets, config.Targets)
+	}
+}
+
+func TestInvalidLinks(t *testing.T) {
+	groupPath := filepath.Join(tmpPath, "group1")
+
+	os.Mkdir(groupPath, 0755)
+	defer os.Remove(groupPath)
+
+	config := &SourceConfig{
+		SourcePath: tmpPath,
+		Groups:     []string{"group1"},
+		Links: map[string]string{
+			"/home/.bashrc":  "bash/bashrc",
+			"/home/.escape":  "../escape",
+			"/home/.profile": "/etc/profile",
+			"relative":       "bash/profile",
+		},
+		GroupLinks: map[string]map[string]string{
+			"group1": {"/home//.vimrc": "./vim/vimrc"},
+			"bogus":  {"/home/.bogus": "bogus"},
+		},
+	}
+
+	errs := SanitizeSourceConfig(config)
+
+	expected := []string{
+		"links: \"/home/.escape\" must link to a dotfile relative to the install path",
+		"links: \"/home/.profile\" must link to a dotfile relative to the install path",
+		"links: link \"relative\" must be an absolute path",
+		"group_links: group \"bogus\" is not a valid group",
+	}
+
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected len(errs) = %d; got %d: %v", len(expected), len(errs), errs)
+	}
+
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("Expected error = %q; got = %q", expected[i], err)
+		}
+	}
+
+	expectedLinks := map[string]string{"/home/.bashrc": "bash/bashrc"}
+
+	if !reflect.DeepEqual(config.Links, expectedLinks) {
+		t.Errorf("Expected links = %v; got = %v", expectedLinks, config.Links)
+	}
+
+	expectedGroupLinks := map[string]map[string]string{
+		"group1": {"/home/.vimrc": "vim/vimrc"},
+	}
+
+	if !reflect.DeepEqual(config.GroupLinks, expectedGroupLinks) {
+		t.Errorf("Expected group links = %v; got = %v", expectedGroupLinks, config.GroupLinks)
+	}
+}
+
+func TestInvalidDirectoryMode(t *testing.T) {
+	config := &SourceConfig{
+		SourcePath:    tmpPath,
+		DirectoryMode: "rwx",
+	}
+
+	errs := SanitizeSourceConfig(config)
+
+	if len(errs) != 1 {
+		t.Fatalf("Expected len(errs) = 1; got %d", len(errs))
+	}
+
+	if errs[0].Error() != "directory_mode: \"rwx\" is not a valid octal file mode" {
+		t.Errorf("Expected invalid directory mode error; got = %q", errs[0])
+	}
+
+	if config.DirectoryFileMode() != DefaultDirectoryMode {
+		t.Errorf("Expected default directory mode; got = %o", config.DirectoryFileMode())
+	}
+}
+
+// TestInvalidSymlinkMode tests that an invalid symlink mode is removed.
+func TestInvalidSymlinkMode(t *testing.T) {
+	config := &SourceConfig{
+		SourcePath: tmpPath,
+		Symlinks:   "follow",
+	}
+
+	errs := SanitizeSourceConfig(config)
+
+	if len(errs) != 1 {
+		t.Fatalf("Expected len(errs) = 1; got %d", len(errs))
+	}
+
+	if errs[0].Error() != "symlinks: \"follow\" is not a valid symlink mode" {
+		t.Errorf("Expected invalid symlink mode error; got = %q", errs[0])
+	}
+
+	if config.Symlinks != "" {
+		t.Errorf("Expected invalid symlink mode to be removed")
+	}
+}
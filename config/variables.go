@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ResolvedVariable represents the effective value of a variable along with
+// where in the configuration the value was defined.
+type ResolvedVariable struct {
+	Value interface{}
+
+	// Source describes where the variable was defined, e.g. `group base`.
+	Source string
+}
+
+// ResolvedVariables is a mapping of variable names to their resolved values.
+type ResolvedVariables map[string]ResolvedVariable
+
+// Names returns the sorted list of variable names.
+func (v ResolvedVariables) Names() []string {
+	names := make([]string, 0, len(v))
+
+	for name := range v {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// Values returns the resolved variables without their sources.
+func (v ResolvedVariables) Values() Variables {
+	values := Variables{}
+
+	for name, variable := range v {
+		values[name] = variable.Value
+	}
+
+	return values
+}
+
+// ResolveVariables merges the configured variables in cascade order. The top
+// level variables are merged first, followed by the variables of each group
+// in the order returned by ResolveGroups, and finally the variables of the
+// active profile.
+func (l *SourceLockfile) ResolveVariables(config SourceConfig) ResolvedVariables {
+	resolved := ResolvedVariables{}
+
+	merge := func(variables Variables, source string) {
+		for name, value := range variables {
+			resolved[name] = ResolvedVariable{Value: value, Source: source}
+		}
+	}
+
+	merge(config.Variables, "variables")
+
+	for _, group := range l.ResolveGroups(config) {
+		merge(config.GroupVariables[group], fmt.Sprintf("group %s", group))
+	}
+
+	if _, ok := config.Profiles[l.Profile]; ok {
+		merge(config.ProfileVariables[l.Profile], fmt.Sprintf("profile %s", l.Profile))
+	}
+
+	return resolved
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveVariables(t *testing.T) {
+	config := SourceConfig{
+		BaseGroups: []string{"base"},
+		Profiles: Profiles{
+			"desktop": []string{"machines/desktop"},
+		},
+		Variables: Variables{
+			"email":     "me@example.com",
+			"font_size": 10,
+			"monitor":   "eDP-1",
+		},
+		GroupVariables: map[string]Variables{
+			"base":             {"font_size": 11},
+			"machines/desktop": {"font_size": 12, "monitor": "DP-1"},
+			"machines/server":  {"monitor": "none"},
+		},
+		ProfileVariables: map[string]Variables{
+			"desktop": {"monitor": "DP-2"},
+		},
+	}
+
+	lockfile := SourceLockfile{Profile: "desktop"}
+
+	expected := ResolvedVariables{
+		"email":     {Value: "me@example.com", Source: "variables"},
+		"font_size": {Value: 12, Source: "group machines/desktop"},
+		"monitor":   {Value: "DP-2", Source: "profile desktop"},
+	}
+
+	resolved := lockfile.ResolveVariables(config)
+
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("Expected = %v; got = %v", expected, resolved)
+	}
+
+	expectedNames := []string{"email", "font_size", "monitor"}
+
+	if names := resolved.Names(); !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("Expected = %v; got = %v", expectedNames, names)
+	}
+}
@@ -1,6 +1,7 @@
 module go.evanpurkhiser.com/dots
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/fatih/color v1.7.0
 	github.com/getsentry/sentry-go v0.1.0
 	github.com/spf13/cobra v0.0.5
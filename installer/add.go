@@ -0,0 +1,80 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+// AddSource copies the file at the path into the group of the source tree,
+// as the source of the dotfile path, keeping its mode. Symlinks are copied as
+// symlinks. The path of the new source is returned. Existing sources are
+// never overwritten.
+func AddSource(path, group, dotfilePath string, conf *config.SourceConfig) (string, error) {
+	sourcePath := group + separator + dotfilePath
+	dest := conf.SourcePath + separator + sourcePath
+
+	if _, err := os.Lstat(dest); err == nil {
+		return "", fmt.Errorf("%s already exists in the sources", sourcePath)
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !info.Mode().IsRegular() && !isSymlink(info) {
+		return "", fmt.Errorf("not a regular file")
+	}
+
+	return sourcePath, copyFile(path, dest, info)
+}
+
+// RecordInstalled records the dotfile in the lockfile as installed, along with
+// the state of the installed file, such that the existing file is owned by
+// dots rather than overwritten when next installed.
+func RecordInstalled(dotfile *resolver.Dotfile, installConfig InstallConfig) error {
+	lockfile := installConfig.SourceLockfile
+	installPath := installConfig.installPath(dotfile)
+
+	prepared := &PreparedDotfile{Dotfile: dotfile}
+
+	state, ok, err := installedBaseState(prepared, installPath, config.FileState{}, installConfig)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("nothing is installed at %s", installPath)
+	}
+
+	if lockfile.InstalledState == nil {
+		lockfile.InstalledState = map[string]config.FileState{}
+	}
+
+	lockfile.InstalledState[installPath] = state
+
+	if slices.Contains(lockfile.InstalledPaths(dotfile.InstallTarget), dotfile.Path) {
+		return nil
+	}
+
+	if dotfile.InstallTarget == "" {
+		lockfile.InstalledFiles = append(lockfile.InstalledFiles, dotfile.Path)
+		return nil
+	}
+
+	if lockfile.InstalledTargets == nil {
+		lockfile.InstalledTargets = map[string]config.InstalledTarget{}
+	}
+
+	target := lockfile.InstalledTargets[dotfile.InstallTarget]
+	target.Path = installConfig.targetPath(dotfile.InstallTarget)
+	target.Files = append(target.Files, dotfile.Path)
+
+	lockfile.InstalledTargets[dotfile.InstallTarget] = target
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+func TestAddSource(t *testing.T) {
+	root := t.TempDir()
+
+	sourceConfig := &config.SourceConfig{
+		SourcePath: filepath.Join(root, "source"),
+		Groups:     []string{"base"},
+	}
+
+	installPath := filepath.Join(root, "home", "app", "config")
+
+	os.MkdirAll(filepath.Dir(installPath), 0755)
+	os.WriteFile(installPath, []byte("config\n"), 0600)
+
+	sourcePath, err := AddSource(installPath, "base", "app/config", sourceConfig)
+	if err != nil {
+		t.Fatalf("Failed to add source: %s", err)
+	}
+
+	if sourcePath != "base/app/config" {
+		t.Errorf("Expected source path = %q; got = %q", "base/app/config", sourcePath)
+	}
+
+	path := filepath.Join(sourceConfig.SourcePath, sourcePath)
+
+	if data, _ := os.ReadFile(path); string(data) != "config\n" {
+		t.Errorf("Expected content = %q; got = %q", "config\n", data)
+	}
+
+	if info, _ := os.Stat(path); info.Mode()&os.ModePerm != 0600 {
+		t.Errorf("Expected mode = %#o; got = %#o", 0600, info.Mode()&os.ModePerm)
+	}
+
+	if _, err := AddSource(installPath, "base", "app/config", sourceConfig); err == nil {
+		t.Errorf("Expected existing source not to be overwritten")
+	}
+}
+
+func TestRecordInstalled(t *testing.T) {
+	root := t.TempDir()
+
+	sourceConfig := &config.SourceConfig{
+		SourcePath:   filepath.Join(root, "source"),
+		InstallPath:  filepath.Join(root, "home"),
+		LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+	}
+
+	installPath := filepath.Join(sourceConfig.InstallPath, "bashrc")
+
+	os.MkdirAll(filepath.Join(sourceConfig.SourcePath, "base"), 0755)
+	os.MkdirAll(sourceConfig.InstallPath, 0755)
+	os.WriteFile(filepath.Join(sourceConfig.SourcePath, "base", "bashrc"), []byte("bashrc\n"), 0644)
+	os.WriteFile(installPath, []byte("bashrc\n"), 0644)
+
+	lockfile := &config.SourceLockfile{}
+
+	installConfig := InstallConfig{
+		SourceConfig:   sourceConfig,
+		SourceLockfile: lockfile,
+	}
+
+	dotfile := &resolver.Dotfile{
+		Path:    "bashrc",
+		Added:   true,
+		Sources: []*resolver.SourceFile{{Group: "base", Path: "base/bashrc"}},
+	}
+
+	for range 2 {
+		if err := RecordInstalled(dotfile, installConfig); err != nil {
+			t.Fatalf("Failed to record installed dotfile: %s", err)
+		}
+	}
+
+	if !slices.Equal(lockfile.InstalledFiles, []string{"bashrc"}) {
+		t.Errorf("Expected installed files = %v; got = %v", []string{"bashrc"}, lockfile.InstalledFiles)
+	}
+
+	if _, ok := lockfile.InstalledState[installPath]; !ok {
+		t.Errorf("Expected the installed state to be recorded")
+	}
+
+	// The recorded dotfile is no longer added, nor locally modified
+	dotfile.Added = false
+
+	prepared := PrepareDotfiles(resolver.Dotfiles{dotfile}, *sourceConfig, *lockfile).Dotfiles[0]
+
+	if prepared.IsChanged() || prepared.LocallyModified || prepared.OverwritesExisting {
+		t.Errorf("Expected recorded dotfile to be in sync")
+	}
+}
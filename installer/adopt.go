@@ -0,0 +1,324 @@
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+// An adoptLayer is a source of a dotfile along with the lines of the compiled
+// dotfile that it produced.
+type adoptLayer struct {
+	source *resolver.SourceFile
+	data   []byte
+
+	// content is the part of the source data compiled into the dotfile.
+	content []byte
+
+	// start and end are the range of compiled lines produced by the layer.
+	start int
+	end   int
+
+	hunks []lineHunk
+}
+
+// AdoptDotfile copies modifications made to the installed dotfile back into
+// its sources, returning the paths of the sources that were changed. The
+// state of the dotfile in the lockfile is updated, such that the dotfile is no
+// longer considered locally modified.
+//
+// The installed dotfile of a single source which is not compiled is copied to
+// the source. Dotfiles concatenated from multiple sources have each changed
+// line attributed to the source that produced it. Dotfiles which are otherwise
+// compiled cannot be adopted, as their output cannot be mapped back onto the
+// sources.
+func AdoptDotfile(dotfile *resolver.Dotfile, installConfig InstallConfig) ([]string, error) {
+	installPath := installConfig.installPath(dotfile)
+
+	if dotfile.Removed || dotfile.Suppressed || dotfile.ManagedLink {
+		return nil, fmt.Errorf("not installed from sources")
+	}
+
+	info, err := os.Lstat(installPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if isSymlink(info) {
+		return nil, fmt.Errorf("installed as a symlink, nothing to adopt")
+	}
+
+	prepared := &PreparedDotfile{Dotfile: dotfile}
+
+	if state, ok := installConfig.SourceLockfile.InstalledState[installPath]; ok {
+		if err := detectModifications(prepared, state, installPath, *installConfig.SourceConfig); err != nil {
+			return nil, err
+		}
+	}
+
+	if prepared.SourcesChanged {
+		return nil, fmt.Errorf("sources have changed since it was last installed, the edits cannot be told apart from the source changes")
+	}
+
+	installed, err := os.ReadFile(installPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := dotfile.ActiveSources()
+
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("not installed from sources")
+	}
+
+	var changed []string
+
+	if shouldCompile(dotfile, *installConfig.SourceConfig) {
+		changed, err = adoptLayers(dotfile, installed, installConfig)
+	} else {
+		changed, err = adoptSource(sources[0], installed, installConfig)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	state, ok, err := installedFileState(dotfile, installPath, *installConfig.SourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok && installConfig.SourceLockfile.InstalledState == nil {
+		installConfig.SourceLockfile.InstalledState = map[string]config.FileState{}
+	}
+
+	if ok {
+		installConfig.SourceLockfile.InstalledState[installPath] = state
+	}
+
+	return changed, nil
+}
+
+// adoptSource writes the installed dotfile to the source, keeping the mode of
+// the source.
+func adoptSource(source *resolver.SourceFile, installed []byte, config InstallConfig) ([]string, error) {
+	path := config.SourceConfig.SourcePath + separator + source.Path
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if isSymlink(info) {
+		return nil, fmt.Errorf("%s is a symlink, nothing to adopt", source.Path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Equal(data, installed) {
+		return []string{}, nil
+	}
+
+	if err := writeFile(path, bytes.NewReader(installed), info.Mode()&os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	return []string{source.Path}, nil
+}
+
+// adoptLayers attributes each changed line of the installed dotfile to the
+// source which produced it, and writes the changed sources. Only dotfiles
+// which are a plain concatenation of their sources can be adopted.
+func adoptLayers(dotfile *resolver.Dotfile, installed []byte, config InstallConfig) ([]string, error) {
+	switch {
+	case dotfile.MergeStrategy != "":
+		return nil, fmt.Errorf("sources are merged as %s, edit the sources directly", dotfile.MergeStrategy)
+	case dotfile.Template:
+		return nil, fmt.Errorf("sources are templates, edit the sources directly")
+	case dotfile.ExpandEnv:
+		return nil, fmt.Errorf("environment variables are expanded, edit the sources directly")
+	}
+
+	sources := dotfile.ActiveSources()
+	layers := make([]*adoptLayer, len(sources))
+
+	for i, source := range sources {
+		data, err := os.ReadFile(config.SourceConfig.SourcePath + separator + source.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case source.Template:
+			return nil, fmt.Errorf("%s is a template, edit the sources directly", source.Path)
+		case source.Patch:
+			return nil, fmt.Errorf("%s is a patch, edit the sources directly", source.Path)
+		case isBinary(data):
+			return nil, fmt.Errorf("%s is binary, edit the sources directly", source.Path)
+		case hasDirectives(data):
+			return nil, fmt.Errorf("%s contains dots directives, edit the sources directly", source.Path)
+		}
+
+		layers[i] = &adoptLayer{source: source, data: data}
+	}
+
+	compiledLines := joinAdoptLayers(layers, dotfile.PreserveWhitespace)
+
+	// The layers must reproduce the compiled dotfile exactly for the changed
+	// lines to be attributed correctly.
+	source, err := openDotfile(dotfile, *config.SourceConfig, *config.SourceLockfile)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	if err := source.ensureCompiled(); err != nil {
+		return nil, err
+	}
+
+	if strings.Join(compiledLines, "") != source.content.String() {
+		return nil, fmt.Errorf("the sources could not be mapped onto the installed dotfile")
+	}
+
+	for _, hunk := range diffLines(compiledLines, splitLines(installed)) {
+		layer := hunkLayer(layers, hunk)
+
+		if layer == nil {
+			lines := fmt.Sprintf("line %d", hunk.start+1)
+
+			if hunk.end > hunk.start+1 {
+				lines = fmt.Sprintf("lines %d-%d", hunk.start+1, hunk.end)
+			}
+
+			return nil, fmt.Errorf("changes to %s span multiple sources, edit the sources directly", lines)
+		}
+
+		layer.hunks = append(layer.hunks, lineHunk{
+			start: hunk.start - layer.start,
+			end:   hunk.end - layer.start,
+			lines: hunk.lines,
+		})
+	}
+
+	changed := []string{}
+
+	for _, layer := range layers {
+		if len(layer.hunks) == 0 {
+			continue
+		}
+
+		if err := writeAdoptLayer(layer, config); err != nil {
+			return nil, err
+		}
+
+		changed = append(changed, layer.source.Path)
+	}
+
+	return changed, nil
+}
+
+// joinAdoptLayers determines the content each layer contributes to the
+// compiled dotfile, in the same way as concatLayers, and the range of the
+// compiled lines it produces. The compiled lines are returned.
+func joinAdoptLayers(layers []*adoptLayer, preserve bool) []string {
+	lines := []string{}
+
+	for i, layer := range layers {
+		layer.content = layer.data
+
+		if !preserve {
+			layer.content = trimWhitespace(layer.content)
+		}
+
+		if i != 0 && !preserve {
+			layer.content = trimWhitespace(trimShebang(layer.content))
+		}
+
+		layer.start, layer.end = len(lines), len(lines)
+
+		if len(layer.content) == 0 {
+			continue
+		}
+
+		content := layer.content
+
+		switch {
+		case !preserve:
+			content = append(append([]byte{}, content...), '\n')
+
+			// Layers are separated by a blank line belonging to no layer
+			if len(lines) > 0 {
+				lines = append(lines, "\n")
+			}
+		case len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n"):
+			lines[len(lines)-1] += "\n"
+		}
+
+		layer.start = len(lines)
+		lines = append(lines, splitLines(content)...)
+		layer.end = len(lines)
+	}
+
+	return lines
+}
+
+// hunkLayer returns the layer which produced the lines changed by the hunk.
+// Lines inserted between two layers belong to the lower layer. Nil is
+// returned when the hunk does not fall within a single layer.
+func hunkLayer(layers []*adoptLayer, hunk lineHunk) *adoptLayer {
+	for _, layer := range layers {
+		if layer.start == layer.end {
+			continue
+		}
+
+		if hunk.start >= layer.start && hunk.end <= layer.end {
+			return layer
+		}
+	}
+
+	return nil
+}
+
+// writeAdoptLayer applies the changed lines of the layer to its source,
+// keeping any content of the source which was not compiled into the dotfile.
+func writeAdoptLayer(layer *adoptLayer, config InstallConfig) error {
+	lines := splitLines(layer.content)
+
+	// A newline is added to the content when it is compiled, separating it
+	// from the following layer, which is not part of the source.
+	addedNewline := !bytes.HasSuffix(layer.content, []byte("\n"))
+
+	if addedNewline {
+		lines[len(lines)-1] += "\n"
+	}
+
+	content := strings.Join(applyHunks(lines, layer.hunks), "")
+
+	if addedNewline {
+		content = strings.TrimSuffix(content, "\n")
+	}
+
+	// The content is the part of the source remaining once whitespace and
+	// shebangs are trimmed, which is always the last occurrence.
+	offset := bytes.LastIndex(layer.data, layer.content)
+
+	data := append([]byte{}, layer.data[:offset]...)
+	data = append(data, content...)
+	data = append(data, layer.data[offset+len(layer.content):]...)
+
+	path := config.SourceConfig.SourcePath + separator + layer.source.Path
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, bytes.NewReader(data), info.Mode()&os.ModePerm)
+}
@@ -0,0 +1,159 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+func TestAdoptDotfile(t *testing.T) {
+	testCases := []struct {
+		caseName  string
+		sources   map[string]string
+		preserve  bool
+		template  bool
+		installed string
+		expected  map[string]string
+		isError   bool
+	}{
+		{
+			caseName:  "Single source",
+			sources:   map[string]string{"base/bashrc": "a\n"},
+			installed: "a\nb\n",
+			expected:  map[string]string{"base/bashrc": "a\nb\n"},
+		},
+		{
+			caseName: "Changes attributed to each layer",
+			sources: map[string]string{
+				"base/bashrc":    "#!/bin/sh\n\na=1\nb=2\n\n",
+				"machine/bashrc": "#!/bin/sh\nc=3\n",
+			},
+			installed: "#!/bin/sh\n\na=1\nb=20\n\nc=3\nd=4\n",
+			expected: map[string]string{
+				"base/bashrc":    "#!/bin/sh\n\na=1\nb=20\n\n",
+				"machine/bashrc": "#!/bin/sh\nc=3\nd=4\n",
+			},
+		},
+		{
+			caseName: "Lines inserted at the end of a layer",
+			sources: map[string]string{
+				"base/bashrc":    "a=1\n",
+				"machine/bashrc": "c=3\n",
+			},
+			installed: "a=1\nb=2\n\nc=3\n",
+			expected: map[string]string{
+				"base/bashrc":    "a=1\nb=2\n",
+				"machine/bashrc": "c=3\n",
+			},
+		},
+		{
+			caseName: "Preserved whitespace",
+			sources: map[string]string{
+				"base/bashrc":    "a=1\n\n",
+				"machine/bashrc": "c=3",
+			},
+			preserve:  true,
+			installed: "a=1\n\nc=30",
+			expected: map[string]string{
+				"base/bashrc":    "a=1\n\n",
+				"machine/bashrc": "c=30",
+			},
+		},
+		{
+			caseName: "Changes spanning layers",
+			sources: map[string]string{
+				"base/bashrc":    "a=1\n",
+				"machine/bashrc": "c=3\n",
+			},
+			installed: "a=1\nc=3\n",
+			isError:   true,
+		},
+		{
+			caseName: "Templated sources",
+			sources: map[string]string{
+				"base/bashrc":    "a=1\n",
+				"machine/bashrc": "c={{ .Vars.c }}\n",
+			},
+			template:  true,
+			installed: "a=1\n\nc=4\n",
+			isError:   true,
+		},
+		{
+			caseName: "Directive sources",
+			sources: map[string]string{
+				"base/bashrc":    "a=1\n# dots:point prompt\n",
+				"machine/bashrc": "c=3\n",
+			},
+			installed: "a=1\nc=3\nd=4\n",
+			isError:   true,
+		},
+		{
+			caseName:  "Sources mentioning directives",
+			sources:   map[string]string{"base/bashrc": "echo 'see dots:point'\n"},
+			installed: "echo 'see dots:point'\nb\n",
+			expected:  map[string]string{"base/bashrc": "echo 'see dots:point'\nb\n"},
+		},
+	}
+
+	for _, testCase := range testCases {
+		root := t.TempDir()
+
+		sourceConfig := &config.SourceConfig{
+			SourcePath:  filepath.Join(root, "source"),
+			InstallPath: filepath.Join(root, "home"),
+		}
+
+		installConfig := InstallConfig{
+			SourceConfig:   sourceConfig,
+			SourceLockfile: &config.SourceLockfile{},
+		}
+
+		dotfile := &resolver.Dotfile{Path: "bashrc", PreserveWhitespace: testCase.preserve}
+
+		for _, path := range []string{"base/bashrc", "machine/bashrc"} {
+			data, ok := testCase.sources[path]
+			if !ok {
+				continue
+			}
+
+			source := &resolver.SourceFile{Path: path, Template: testCase.template}
+			dotfile.Sources = append(dotfile.Sources, source)
+
+			os.MkdirAll(filepath.Dir(filepath.Join(sourceConfig.SourcePath, path)), 0755)
+			os.WriteFile(filepath.Join(sourceConfig.SourcePath, path), []byte(data), 0644)
+		}
+
+		os.MkdirAll(sourceConfig.InstallPath, 0755)
+		os.WriteFile(filepath.Join(sourceConfig.InstallPath, "bashrc"), []byte(testCase.installed), 0644)
+
+		_, err := AdoptDotfile(dotfile, installConfig)
+
+		if testCase.isError {
+			if err == nil {
+				t.Errorf("Test %q expected error", testCase.caseName)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Test %q failed: %s", testCase.caseName, err)
+			continue
+		}
+
+		for path, expected := range testCase.expected {
+			if data, _ := os.ReadFile(filepath.Join(sourceConfig.SourcePath, path)); string(data) != expected {
+				t.Errorf("Test %q expected %s = %q; got = %q", testCase.caseName, path, expected, data)
+			}
+		}
+
+		installPath := filepath.Join(sourceConfig.InstallPath, "bashrc")
+
+		if _, ok := installConfig.SourceLockfile.InstalledState[installPath]; !ok {
+			t.Errorf("Test %q expected the installed state to be recorded", testCase.caseName)
+		}
+	}
+}
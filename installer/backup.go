@@ -0,0 +1,250 @@
+package installer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.evanpurkhiser.com/dots/config"
+)
+
+// backupRunFormat is the time format used to name backup runs. Runs created
+// within the same second are suffixed with a number.
+const backupRunFormat = "20060102-150405"
+
+// BackupsPath returns the directory backups are stored in, which lives along
+// side the lockfile.
+func BackupsPath(config *config.SourceConfig) string {
+	return filepath.Join(filepath.Dir(config.LockfilePath), "backups")
+}
+
+// BackupRun saves the previous content of files which are overwritten or
+// removed during a single install run. Files are stored within the run
+// directory at their absolute path, preserving their mode. Symlinks are saved
+// as symlinks.
+type BackupRun struct {
+	// ID identifies the run within the backups directory.
+	ID string
+
+	// Path is the directory the files of the run are stored in. The directory
+	// is only created once a file is saved.
+	Path string
+
+	mutex sync.Mutex
+	saved []string
+}
+
+// NewBackupRun creates a backup run named after the current time. A suffix is
+// added when a run of the same name already exists.
+func NewBackupRun(config *config.SourceConfig) *BackupRun {
+	backupsPath := BackupsPath(config)
+	id := time.Now().Format(backupRunFormat)
+
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(filepath.Join(backupsPath, id)); os.IsNotExist(err) {
+			break
+		}
+
+		id = fmt.Sprintf("%s-%d", time.Now().Format(backupRunFormat), i)
+	}
+
+	return &BackupRun{ID: id, Path: filepath.Join(backupsPath, id)}
+}
+
+// Saved returns the list of files saved in the run.
+func (b *BackupRun) Saved() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return append([]string{}, b.saved...)
+}
+
+// Save copies the file at the path into the run. Paths which do not exist, or
+// are directories, have nothing to save. Only the first content saved for a
+// path is kept.
+func (b *BackupRun) Save(path string) error {
+	for _, saved := range b.Saved() {
+		if saved == path {
+			return nil
+		}
+	}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() {
+		return nil
+	}
+
+	if err := copyFile(path, b.Path+separator+path, info); err != nil {
+		return fmt.Errorf("failed to backup %s: %s", path, err)
+	}
+
+	b.mutex.Lock()
+	b.saved = append(b.saved, path)
+	b.mutex.Unlock()
+
+	return nil
+}
+
+// ListBackupRuns returns the IDs of all backup runs, oldest first.
+func ListBackupRuns(config *config.SourceConfig) ([]string, error) {
+	entries, err := os.ReadDir(BackupsPath(config))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []string{}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			runs = append(runs, entry.Name())
+		}
+	}
+
+	sort.Slice(runs, func(i, j int) bool {
+		createdI, numberI := parseBackupRun(runs[i])
+		createdJ, numberJ := parseBackupRun(runs[j])
+
+		if !createdI.Equal(createdJ) {
+			return createdI.Before(createdJ)
+		}
+
+		if numberI != numberJ {
+			return numberI < numberJ
+		}
+
+		return runs[i] < runs[j]
+	})
+
+	return runs, nil
+}
+
+// parseBackupRun parses the time a backup run was created and its suffix
+// number from its ID. Runs without a suffix are numbered zero.
+func parseBackupRun(id string) (time.Time, int) {
+	if len(id) < len(backupRunFormat) {
+		return time.Time{}, 0
+	}
+
+	created, _ := time.Parse(backupRunFormat, id[:len(backupRunFormat)])
+	number, _ := strconv.Atoi(strings.TrimPrefix(id[len(backupRunFormat):], "-"))
+
+	return created, number
+}
+
+// BackupFiles returns the absolute paths of the files saved in the backup run.
+func BackupFiles(config *config.SourceConfig, run string) ([]string, error) {
+	runPath := filepath.Join(BackupsPath(config), run)
+
+	if _, err := os.Stat(runPath); err != nil {
+		return nil, fmt.Errorf("backup run %q does not exist", run)
+	}
+
+	files := []string{}
+
+	walker := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		files = append(files, strings.TrimPrefix(path, runPath))
+
+		return nil
+	}
+
+	if err := filepath.Walk(runPath, walker); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// RestoreBackup puts the file saved in the backup run back at its path. The
+// current file, if any, is first saved into the given backup run so that the
+// restore may itself be undone.
+func RestoreBackup(config *config.SourceConfig, run, path string, backup *BackupRun) error {
+	backupPath := filepath.Join(BackupsPath(config), run) + path
+
+	info, err := os.Lstat(backupPath)
+	if err != nil {
+		return err
+	}
+
+	if backup != nil {
+		if err := backup.Save(path); err != nil {
+			return err
+		}
+	}
+
+	existing, err := os.Lstat(path)
+	if err == nil && existing.IsDir() {
+		return fmt.Errorf("refusing to replace directory %s", path)
+	}
+
+	if err == nil {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	return copyFile(backupPath, path, info)
+}
+
+// copyFile copies the file, or symlink, described by the info to the
+// destination, creating any missing parent directories.
+func copyFile(source, dest string, info os.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(dest), config.DefaultDirectoryMode); err != nil {
+		return err
+	}
+
+	if isSymlink(info) {
+		target, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+
+		return os.Symlink(target, dest)
+	}
+
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	flags := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+
+	destFile, err := os.OpenFile(dest, flags, info.Mode()&os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer destFile.Close()
+
+	if _, err := io.Copy(destFile, sourceFile); err != nil {
+		return err
+	}
+
+	// The mode given when opening the file is subject to the umask
+	return destFile.Chmod(info.Mode() & os.ModePerm)
+}
@@ -0,0 +1,102 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+)
+
+func TestBackupRestore(t *testing.T) {
+	root := t.TempDir()
+
+	conf := &config.SourceConfig{
+		LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+	}
+
+	filePath := filepath.Join(root, "home", "bashrc")
+	linkPath := filepath.Join(root, "home", "profile")
+
+	os.MkdirAll(filepath.Dir(filePath), 0755)
+	os.WriteFile(filePath, []byte("original\n"), 0600)
+	os.Symlink("bashrc", linkPath)
+
+	backups := NewBackupRun(conf)
+
+	for _, path := range []string{filePath, linkPath, filePath, filepath.Join(root, "missing")} {
+		if err := backups.Save(path); err != nil {
+			t.Fatalf("Failed to save backup: %s", err)
+		}
+	}
+
+	if saved := backups.Saved(); !reflect.DeepEqual(saved, []string{filePath, linkPath}) {
+		t.Errorf("Expected saved = %v; got = %v", []string{filePath, linkPath}, saved)
+	}
+
+	os.WriteFile(filePath, []byte("replaced\n"), 0644)
+	os.Remove(linkPath)
+
+	runs, err := ListBackupRuns(conf)
+	if err != nil || !reflect.DeepEqual(runs, []string{backups.ID}) {
+		t.Fatalf("Expected runs = %v; got = %v (%v)", []string{backups.ID}, runs, err)
+	}
+
+	files, err := BackupFiles(conf, backups.ID)
+	if err != nil {
+		t.Fatalf("Failed to list backup files: %s", err)
+	}
+
+	restoreBackups := NewBackupRun(conf)
+
+	for _, file := range files {
+		if err := RestoreBackup(conf, backups.ID, file, restoreBackups); err != nil {
+			t.Fatalf("Failed to restore %s: %s", file, err)
+		}
+	}
+
+	if data, _ := os.ReadFile(filePath); string(data) != "original\n" {
+		t.Errorf("Expected restored content = %q; got = %q", "original\n", data)
+	}
+
+	if info, _ := os.Stat(filePath); info.Mode()&os.ModePerm != 0600 {
+		t.Errorf("Expected restored mode = %#o; got = %#o", 0600, info.Mode()&os.ModePerm)
+	}
+
+	if target, _ := os.Readlink(linkPath); target != "bashrc" {
+		t.Errorf("Expected restored link target = %q; got = %q", "bashrc", target)
+	}
+
+	if saved := restoreBackups.Saved(); !reflect.DeepEqual(saved, []string{filePath}) {
+		t.Errorf("Expected replaced files to be saved = %v; got = %v", []string{filePath}, saved)
+	}
+}
+
+func TestListBackupRuns(t *testing.T) {
+	root := t.TempDir()
+
+	conf := &config.SourceConfig{
+		LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+	}
+
+	expected := []string{
+		"20231231-235959",
+		"20240101-120000",
+		"20240101-120000-2",
+		"20240101-120000-10",
+	}
+
+	for _, run := range []string{expected[3], expected[1], expected[0], expected[2]} {
+		os.MkdirAll(filepath.Join(BackupsPath(conf), run), 0755)
+	}
+
+	runs, err := ListBackupRuns(conf)
+	if err != nil {
+		t.Fatalf("Failed to list backup runs: %s", err)
+	}
+
+	if !reflect.DeepEqual(runs, expected) {
+		t.Errorf("Expected runs = %v; got = %v", expected, runs)
+	}
+}
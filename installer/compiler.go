@@ -2,6 +2,7 @@ package installer
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 
@@ -11,53 +12,287 @@ import (
 
 type dotfileCompiler struct {
 	dotfile  *resolver.Dotfile
+	sources  []*resolver.SourceFile
 	content  *bytes.Buffer
 	compiled bool
 	config   config.SourceConfig
+	lockfile config.SourceLockfile
 	files    []*os.File
+
+	data     *TemplateData
+	warnings []string
 }
 
-// ensureCompiled transforms the source dotfiles into the dotfile output. It
-// will not recompile if the dotfile has already been compiled.
-func (c *dotfileCompiler) ensureCompiled() error {
-	if c.compiled {
-		return nil
+// templateData resolves the data used to render templates and expand
+// variables. The data is only resolved once per compiler.
+func (c *dotfileCompiler) templateData() TemplateData {
+	if c.data == nil {
+		data := NewTemplateData(c.config, c.lockfile)
+		c.data = &data
 	}
 
-	compiledData := []byte{}
+	return *c.data
+}
+
+// readSources reads the unmodified data of each source file of the dotfile.
+func (c *dotfileCompiler) readSources() ([][]byte, error) {
+	sources := make([][]byte, len(c.files))
 
 	for i, sourceFile := range c.files {
 		data, err := io.ReadAll(sourceFile)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		// 1. Always trim whitespace off of the source file.
-		data = trimWhitespace(data)
+		sources[i] = data
+	}
+
+	return sources, nil
+}
+
+// transformLayers renders any templated sources and evaluates conditional
+// blocks of each source, producing the layers to be combined.
+func (c *dotfileCompiler) transformLayers(sources [][]byte) ([][]byte, error) {
+	layers := make([][]byte, len(sources))
+
+	for i, data := range sources {
+		source := c.sources[i]
+
+		var err error
+
+		if source.Template || c.dotfile.Template {
+			data, err = renderTemplate(source.Path, data, c.templateData())
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !source.Patch && hasDirectives(data) {
+			data, err = evaluateConditionals(source.Path, data, c.templateData().Facts)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		layers[i] = data
+	}
+
+	return layers, nil
+}
+
+// concatLayers joins the layers of a dotfile together linearly. Content of a
+// layer targeting a named insertion point of the lower layers is inserted at
+// that point instead. The names are used to identify layers in warnings.
+//
+// Unless the dotfile preserves whitespace, layers are normalized by trimming
+// whitespace and shebangs of later layers.
+func (c *dotfileCompiler) concatLayers(names []string, layers [][]byte) []byte {
+	preserve := c.dotfile.PreserveWhitespace
+
+	normalize := func(d []byte) []byte {
+		if preserve {
+			return d
+		}
+
+		return trimWhitespace(d)
+	}
+
+	compiledData := []byte{}
+
+	for i, data := range layers {
+		// 1. Trim whitespace off of the source file, unless whitespace is
+		//    being preserved.
+		data = normalize(data)
 
 		// 2. For any source file that proceeds after the first, trim shebang
 		//    markers for cleanliness of bash configurations. We trim whitespace
-		//    again to remove any space after the shebang.
-		if i != 0 {
+		//    again to remove any space after the shebang. Shebangs are kept
+		//    when preserving whitespace.
+		if i != 0 && !preserve {
 			data = trimShebang(data)
 			data = trimWhitespace(data)
 		}
 
-		// Combine files with *one* blank line between them
-		if i != 0 {
-			compiledData = append(compiledData, '\n', '\n')
+		// 3. Insert content targeting named insertion points. Content targeting
+		//    a point that does not exist is appended with a warning.
+		data, insertions := splitInsertions(data)
+		data = normalize(data)
+
+		for _, insertion := range insertions {
+			content := trimWhitespace(insertion.content)
+			if preserve {
+				content = bytes.TrimSuffix(insertion.content, []byte("\n"))
+			}
+
+			var inserted bool
+			compiledData, inserted = insertAtPoint(compiledData, insertion.point, content)
+
+			if inserted {
+				continue
+			}
+
+			c.warnings = append(c.warnings, fmt.Sprintf(
+				"%s: insertion point %q does not exist",
+				names[i],
+				insertion.point,
+			))
+
+			if preserve {
+				content = insertion.content
+			}
+
+			data = joinLayers(data, content, preserve)
+		}
+
+		compiledData = joinLayers(compiledData, data, preserve)
+	}
+
+	// 4. Insertion point markers are never included in the output
+	compiledData = stripPoints(compiledData)
+
+	if preserve {
+		return compiledData
+	}
+
+	// All files should end with a single newline
+	return append(trimWhitespace(compiledData), '\n')
+}
+
+// joinLayers appends the upper layer to the lower layer. Layers are combined
+// with *one* blank line between them. When preserving whitespace the layers
+// are joined exactly, only separating them by a newline when the lower layer
+// does not end with one.
+func joinLayers(lower, upper []byte, preserve bool) []byte {
+	if len(upper) == 0 {
+		return lower
+	}
+
+	if len(lower) == 0 {
+		return append(lower, upper...)
+	}
+
+	if !preserve {
+		lower = append(lower, '\n', '\n')
+	} else if !bytes.HasSuffix(lower, []byte("\n")) {
+		lower = append(lower, '\n')
+	}
+
+	return append(lower, upper...)
+}
+
+// combineLayers combines layers using the merge strategy of the dotfile.
+// Structured dotfiles are deep merged, everything else is concatenated.
+func (c *dotfileCompiler) combineLayers(names []string, layers [][]byte) ([]byte, error) {
+	if len(layers) == 0 {
+		return []byte{}, nil
+	}
+
+	if c.dotfile.MergeStrategy != "" {
+		return mergeLayers(c.dotfile.MergeStrategy, names, layers)
+	}
+
+	return c.concatLayers(names, layers), nil
+}
+
+// compile transforms the source dotfiles into the dotfile output.
+func (c *dotfileCompiler) compile() ([]byte, error) {
+	sources, err := c.readSources()
+	if err != nil {
+		return nil, err
+	}
+
+	// Dotfiles which do not require any transformations are installed exactly
+	// as their source file.
+	if !requiresCompile(c.dotfile, c.sources, sources) {
+		return bytes.Join(sources, nil), nil
+	}
+
+	for i, data := range sources {
+		if isBinary(data) {
+			return c.compileBinary(sources, i)
+		}
+	}
+
+	layers, err := c.transformLayers(sources)
+	if err != nil {
+		return nil, err
+	}
+
+	// Layers are combined until a patch source is reached, the patch is then
+	// applied to the combined layers, producing the first layer of the next
+	// set of layers to combine.
+	combineNames := []string{}
+	combineLayers := [][]byte{}
+
+	for i, layer := range layers {
+		source := c.sources[i]
+
+		if !source.Patch {
+			combineNames = append(combineNames, source.Path)
+			combineLayers = append(combineLayers, layer)
+			continue
 		}
 
-		compiledData = append(compiledData, data...)
+		combined, err := c.combineLayers(combineNames, combineLayers)
+		if err != nil {
+			return nil, err
+		}
+
+		patched, err := applyPatch(source.Path, combined, layer)
+		if err != nil {
+			return nil, err
+		}
+
+		combineNames = []string{source.Path}
+		combineLayers = [][]byte{patched}
+	}
+
+	compiledData, err := c.combineLayers(combineNames, combineLayers)
+	if err != nil {
+		return nil, err
 	}
 
-	// 3. Expand environment variables if the dotfile was marked.
+	// Expand environment variables if the dotfile was marked. User defined
+	// variables take precedence over the environment.
 	if c.dotfile.ExpandEnv {
-		compiledData = expandEnvironment(compiledData)
+		compiledData = expandEnvironment(compiledData, c.templateData().Vars)
+	}
+
+	return compiledData, nil
+}
+
+// compileBinary compiles a dotfile with a binary source. Binary sources cannot
+// be transformed or combined, so the highest source is installed unmodified.
+func (c *dotfileCompiler) compileBinary(sources [][]byte, binaryIndex int) ([]byte, error) {
+	last := len(c.sources) - 1
+	source := c.sources[last]
+
+	if source.Patch {
+		return nil, fmt.Errorf("%s: binary sources cannot be patched", source.Path)
+	}
+
+	if len(c.sources) > 1 {
+		c.warnings = append(c.warnings, fmt.Sprintf(
+			"%s: binary sources cannot be combined, only %s is installed",
+			c.sources[binaryIndex].Path,
+			source.Path,
+		))
 	}
 
-	// 4. All files should end with a single newline
-	compiledData = append(compiledData, '\n')
+	return sources[last], nil
+}
+
+// ensureCompiled compiles the dotfile. It will not recompile if the dotfile
+// has already been compiled.
+func (c *dotfileCompiler) ensureCompiled() error {
+	if c.compiled {
+		return nil
+	}
+
+	compiledData, err := c.compile()
+	if err != nil {
+		return err
+	}
 
 	// Store the compiled dotfile
 	c.compiled = true
@@ -70,7 +305,10 @@ func (c *dotfileCompiler) ensureCompiled() error {
 // Read implements the io.Reader interface. Calling read will compile the
 // dotfile into it's final byte slice.
 func (c *dotfileCompiler) Read(p []byte) (int, error) {
-	c.ensureCompiled()
+	if err := c.ensureCompiled(); err != nil {
+		return 0, err
+	}
+
 	return c.content.Read(p)
 }
 
@@ -89,11 +327,20 @@ func (c *dotfileCompiler) Close() error {
 	return err
 }
 
-// OpenDotfile opens a source dotfile for streaming compilation.
-func OpenDotfile(dotfile *resolver.Dotfile, config config.SourceConfig) (io.ReadCloser, error) {
-	files := make([]*os.File, len(dotfile.Sources))
+// OpenDotfile opens a source dotfile for streaming compilation. The lockfile is
+// used to resolve the data that templated sources are rendered against. Only
+// the active sources of the dotfile are compiled, sources discarded by an
+// override are never opened.
+func OpenDotfile(dotfile *resolver.Dotfile, config config.SourceConfig, lockfile config.SourceLockfile) (io.ReadCloser, error) {
+	return openDotfile(dotfile, config, lockfile)
+}
+
+// openDotfile opens a dotfileCompiler for the dotfile.
+func openDotfile(dotfile *resolver.Dotfile, config config.SourceConfig, lockfile config.SourceLockfile) (*dotfileCompiler, error) {
+	sources := dotfile.ActiveSources()
+	files := make([]*os.File, len(sources))
 
-	for i, source := range dotfile.Sources {
+	for i, source := range sources {
 		file, err := os.Open(config.SourcePath + separator + source.Path)
 		if err != nil {
 			return nil, err
@@ -103,25 +350,63 @@ func OpenDotfile(dotfile *resolver.Dotfile, config config.SourceConfig) (io.Read
 	}
 
 	compiler := &dotfileCompiler{
-		dotfile: dotfile,
-		content: bytes.NewBuffer(nil),
-		config:  config,
-		files:   files,
+		dotfile:  dotfile,
+		sources:  sources,
+		content:  bytes.NewBuffer(nil),
+		config:   config,
+		lockfile: lockfile,
+		files:    files,
 	}
 
 	return compiler, nil
 }
 
-// mustCompile indicates if a dotfile must be compiled, or if a single-source
+// shouldCompile indicates if a dotfile must be compiled, or if a single-source
 // dotfile does not require any transformations and may be directly installed.
 func shouldCompile(dotfile *resolver.Dotfile, config config.SourceConfig) bool {
-	if len(dotfile.Sources) > 1 {
+	sources := dotfile.ActiveSources()
+
+	if len(sources) > 1 {
 		return true
 	}
 
-	if dotfile.ExpandEnv {
+	data := make([][]byte, len(sources))
+
+	for i, source := range sources {
+		sourceData, err := os.ReadFile(config.SourcePath + separator + source.Path)
+
+		// An unreadable source must be compiled so that the error may be
+		// surfaced when compiling.
+		if err != nil {
+			return true
+		}
+
+		data[i] = sourceData
+	}
+
+	return requiresCompile(dotfile, sources, data)
+}
+
+// requiresCompile indicates if the data of the sources must be transformed to
+// produce the dotfile. Binary sources are never transformed.
+func requiresCompile(dotfile *resolver.Dotfile, sources []*resolver.SourceFile, data [][]byte) bool {
+	if len(sources) > 1 {
 		return true
 	}
 
+	for i, source := range sources {
+		if isBinary(data[i]) {
+			return false
+		}
+
+		if dotfile.ExpandEnv || dotfile.Template || source.Template || source.Patch {
+			return true
+		}
+
+		if hasDirectives(data[i]) {
+			return true
+		}
+	}
+
 	return false
 }
@@ -0,0 +1,82 @@
+package installer
+
+import (
+	"reflect"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+func TestConcatLayers(t *testing.T) {
+	testCases := []struct {
+		caseName         string
+		layers           []string
+		preserve         bool
+		expected         string
+		expectedWarnings []string
+	}{
+		{
+			caseName: "Linear append",
+			layers:   []string{"#!/bin/bash\none\n\n", "#!/bin/bash\n\ntwo"},
+			expected: "#!/bin/bash\none\n\ntwo\n",
+		},
+		{
+			caseName: "Named insertion points",
+			layers: []string{
+				"one\n# dots:point middle\nthree\n// dots:point unused\n",
+				"# dots:insert middle\ntwo\n",
+				"four\n; dots:insert middle\ntwo and a half\n",
+			},
+			expected: "one\ntwo\ntwo and a half\nthree\n\nfour\n",
+		},
+		{
+			caseName: "Missing insertion point",
+			layers: []string{
+				"one\n",
+				"# dots:insert missing\ntwo\n",
+			},
+			expected:         "one\n\ntwo\n",
+			expectedWarnings: []string{`layer1: insertion point "missing" does not exist`},
+		},
+		{
+			caseName: "Preserved whitespace",
+			layers:   []string{"#!/bin/bash\none\n\n", "#!/bin/bash\n\ttwo", "\tthree"},
+			preserve: true,
+			expected: "#!/bin/bash\none\n\n#!/bin/bash\n\ttwo\n\tthree",
+		},
+		{
+			caseName: "Preserved whitespace with insertion points",
+			layers: []string{
+				"all:\n# dots:point targets\n\n",
+				"# dots:insert targets\n\tmake one\n",
+				"# dots:insert missing\n\tmake two\n",
+			},
+			preserve:         true,
+			expected:         "all:\n\tmake one\n\n\tmake two\n",
+			expectedWarnings: []string{`layer2: insertion point "missing" does not exist`},
+		},
+	}
+
+	for _, testCase := range testCases {
+		names := make([]string, len(testCase.layers))
+		layers := make([][]byte, len(testCase.layers))
+
+		for i, layer := range testCase.layers {
+			names[i] = "layer" + string(rune('0'+i))
+			layers[i] = []byte(layer)
+		}
+
+		compiler := &dotfileCompiler{
+			dotfile: &resolver.Dotfile{PreserveWhitespace: testCase.preserve},
+		}
+		actual := compiler.concatLayers(names, layers)
+
+		if string(actual) != testCase.expected {
+			t.Errorf("Expected = %q; got = %q, %s", testCase.expected, actual, testCase.caseName)
+		}
+
+		if !reflect.DeepEqual(compiler.warnings, testCase.expectedWarnings) {
+			t.Errorf("Expected warnings = %v; got = %v, %s", testCase.expectedWarnings, compiler.warnings, testCase.caseName)
+		}
+	}
+}
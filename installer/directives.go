@@ -0,0 +1,251 @@
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"go.evanpurkhiser.com/dots/config"
+)
+
+// directiveRegex matches lines containing a dots directive within a comment,
+// e.g. `# dots:point prompt`. Any common comment leader may be used. The `"`
+// leader of Vim comments must be followed by whitespace, so that quoted JSON
+// keys such as `"dots:if": true` are not directives.
+var directiveRegex = regexp.MustCompile(`^\s*(?:(?:#|//|;|--)\s*|"\s+)dots:([a-z]+)\b\s*(.*?)\s*$`)
+
+// directive represents a single dots directive comment.
+type directive struct {
+	name string
+	args string
+}
+
+// parseDirective parses a dots directive from a line.
+func parseDirective(line []byte) (directive, bool) {
+	match := directiveRegex.FindSubmatch(line)
+	if match == nil {
+		return directive{}, false
+	}
+
+	return directive{name: string(match[1]), args: string(match[2])}, true
+}
+
+// hasDirectives reports if any line of the data is a dots directive. Content
+// merely mentioning dots directives, outside of a directive comment, has none.
+func hasDirectives(data []byte) bool {
+	for line := range bytes.Lines(data) {
+		if directiveRegex.Match(line) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Insertion point directives. A lower layer marks a named insertion point with
+// the point directive, while a higher layer may use the insert directive to
+// target the point. All content following the insert directive, up until the
+// next insert directive, will be inserted at the point.
+const (
+	pointDirective  = "point"
+	insertDirective = "insert"
+)
+
+// insertion represents content of a layer targeting a named insertion point.
+type insertion struct {
+	point   string
+	content []byte
+}
+
+// splitInsertions splits a layer into the content that will be appended to
+// the lower layers and the content that targets named insertion points. The
+// content of each insertion is newline terminated.
+func splitInsertions(d []byte) ([]byte, []insertion) {
+	trailingNewline := bytes.HasSuffix(d, []byte("\n"))
+	lines := bytes.Split(bytes.TrimSuffix(d, []byte("\n")), []byte("\n"))
+
+	appended := [][]byte{}
+	insertions := []insertion{}
+
+	var current *insertion
+
+	for _, line := range lines {
+		if directive, ok := parseDirective(line); ok && directive.name == insertDirective {
+			insertions = append(insertions, insertion{point: directive.args})
+			current = &insertions[len(insertions)-1]
+			continue
+		}
+
+		if current == nil {
+			appended = append(appended, line)
+			continue
+		}
+
+		current.content = append(current.content, line...)
+		current.content = append(current.content, '\n')
+	}
+
+	data := bytes.Join(appended, []byte("\n"))
+
+	if trailingNewline && len(appended) > 0 {
+		data = append(data, '\n')
+	}
+
+	return data, insertions
+}
+
+// insertAtPoint inserts content on the line before the named insertion point
+// marker, keeping the marker so that further layers may also insert at the
+// point. False is returned if the insertion point does not exist.
+func insertAtPoint(d []byte, point string, content []byte) ([]byte, bool) {
+	lines := bytes.Split(d, []byte("\n"))
+
+	for i, line := range lines {
+		directive, ok := parseDirective(line)
+		if !ok || directive.name != pointDirective || directive.args != point {
+			continue
+		}
+
+		inserted := append([][]byte{}, lines[:i]...)
+		inserted = append(inserted, content)
+		inserted = append(inserted, lines[i:]...)
+
+		return bytes.Join(inserted, []byte("\n")), true
+	}
+
+	return d, false
+}
+
+// stripPoints removes all insertion point markers.
+func stripPoints(d []byte) []byte {
+	lines := bytes.Split(d, []byte("\n"))
+	stripped := make([][]byte, 0, len(lines))
+
+	for _, line := range lines {
+		if directive, ok := parseDirective(line); ok && directive.name == pointDirective {
+			continue
+		}
+
+		stripped = append(stripped, line)
+	}
+
+	return bytes.Join(stripped, []byte("\n"))
+}
+
+// Conditional directives. Lines between an if directive and the matching end
+// directive are only included when the condition matches the facts of the
+// machine, e.g:
+//
+//	# dots:if group machines/desktop
+//	# dots:elif not os darwin
+//	# dots:else
+//	# dots:end
+//
+// Conditions take the form `[not] <kind> <value...>`, matching when any of the
+// values match. Conditional blocks may be nested.
+const (
+	ifDirective   = "if"
+	elifDirective = "elif"
+	elseDirective = "else"
+	endDirective  = "end"
+)
+
+// conditionalFrame tracks the state of a single conditional block.
+type conditionalFrame struct {
+	line         int
+	parentActive bool
+	active       bool
+	taken        bool
+	seenElse     bool
+}
+
+// evaluateConditionals removes the lines of conditional blocks which do not
+// match the facts, along with the directive lines themselves. The name is used
+// to identify the source in errors.
+func evaluateConditionals(name string, d []byte, facts config.Facts) ([]byte, error) {
+	lines := bytes.Split(d, []byte("\n"))
+	output := make([][]byte, 0, len(lines))
+
+	stack := []*conditionalFrame{}
+
+	active := func() bool {
+		return len(stack) == 0 || stack[len(stack)-1].active
+	}
+
+	for i, line := range lines {
+		lineNumber := i + 1
+
+		directive, ok := parseDirective(line)
+		if !ok {
+			if active() {
+				output = append(output, line)
+			}
+			continue
+		}
+
+		lineErr := func(format string, v ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", name, lineNumber, fmt.Sprintf(format, v...))
+		}
+
+		switch directive.name {
+		case ifDirective:
+			matched, err := facts.MatchCondition(directive.args)
+			if err != nil {
+				return nil, lineErr("%s", err)
+			}
+
+			stack = append(stack, &conditionalFrame{
+				line:         lineNumber,
+				parentActive: active(),
+				active:       active() && matched,
+				taken:        matched,
+			})
+		case elifDirective:
+			if len(stack) == 0 {
+				return nil, lineErr("dots:elif without dots:if")
+			}
+
+			frame := stack[len(stack)-1]
+			if frame.seenElse {
+				return nil, lineErr("dots:elif after dots:else")
+			}
+
+			matched, err := facts.MatchCondition(directive.args)
+			if err != nil {
+				return nil, lineErr("%s", err)
+			}
+
+			frame.active = frame.parentActive && !frame.taken && matched
+			frame.taken = frame.taken || matched
+		case elseDirective:
+			if len(stack) == 0 {
+				return nil, lineErr("dots:else without dots:if")
+			}
+
+			frame := stack[len(stack)-1]
+			if frame.seenElse {
+				return nil, lineErr("dots:else after dots:else")
+			}
+
+			frame.active = frame.parentActive && !frame.taken
+			frame.taken = true
+			frame.seenElse = true
+		case endDirective:
+			if len(stack) == 0 {
+				return nil, lineErr("dots:end without dots:if")
+			}
+
+			stack = stack[:len(stack)-1]
+		default:
+			if active() {
+				output = append(output, line)
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("%s:%d: dots:if without dots:end", name, stack[len(stack)-1].line)
+	}
+
+	return bytes.Join(output, []byte("\n")), nil
+}
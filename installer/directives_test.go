@@ -0,0 +1,139 @@
+package installer
+
+import (
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+)
+
+func TestParseDirective(t *testing.T) {
+	testCases := []struct {
+		input    string
+		name     string
+		args     string
+		expected bool
+	}{
+		{"# dots:point prompt", "point", "prompt", true},
+		{"  // dots:insert prompt  ", "insert", "prompt", true},
+		{"\" dots:else", "else", "", true},
+		{"; dots:if os linux", "if", "os linux", true},
+		{"echo dots:point prompt", "", "", false},
+		{"\"dots:if\": true,", "", "", false},
+		{"# a regular comment", "", "", false},
+	}
+
+	for _, testCase := range testCases {
+		directive, ok := parseDirective([]byte(testCase.input))
+
+		if ok != testCase.expected {
+			t.Errorf("Expected ok = %t for %q", testCase.expected, testCase.input)
+			continue
+		}
+
+		if directive.name != testCase.name || directive.args != testCase.args {
+			t.Errorf("Expected directive = %s %q; got = %s %q", testCase.name, testCase.args, directive.name, directive.args)
+		}
+	}
+}
+
+func TestHasDirectives(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected bool
+	}{
+		{"a\n# dots:if os linux\nb\n# dots:end\n", true},
+		{"a\n  // dots:point prompt", true},
+		{"echo 'see dots:point in the docs'\n", false},
+		{"url = https://example.com/dots:8080\n", false},
+		{"{\n  \"dots:if\": true\n}\n", false},
+		{"", false},
+	}
+
+	for _, testCase := range testCases {
+		if result := hasDirectives([]byte(testCase.input)); result != testCase.expected {
+			t.Errorf("Expected hasDirectives = %t for %q", testCase.expected, testCase.input)
+		}
+	}
+}
+
+func TestEvaluateConditionals(t *testing.T) {
+	facts := config.Facts{
+		Hostname: "desktop",
+		OS:       "linux",
+		Arch:     "amd64",
+		Profile:  "home",
+		Groups:   []string{"base", "machines/desktop"},
+	}
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"one\n# dots:if group machines/desktop\ntwo\n# dots:end\nthree",
+			"one\ntwo\nthree",
+		},
+		{
+			"// dots:if os darwin\nmac\n// dots:elif os linux\nlinux\n// dots:else\nother\n// dots:end",
+			"linux",
+		},
+		{
+			"\" dots:if not hostname desktop\nnot desktop\n\" dots:else\ndesktop\n\" dots:end",
+			"desktop",
+		},
+		{
+			"; dots:if profile home\n; dots:if arch arm64\narm\n; dots:end\nhome\n; dots:end",
+			"home",
+		},
+		{
+			"# dots:if os darwin\n# dots:if os linux\nnever\n# dots:end\n# dots:else\nelse\n# dots:end",
+			"else",
+		},
+		{
+			"# dots:point prompt\n# dots:if os darwin\n# dots:insert prompt\n# dots:end",
+			"# dots:point prompt",
+		},
+		{
+			"{\n  \"dots:if\": true,\n  \"dots:end\": false\n}",
+			"{\n  \"dots:if\": true,\n  \"dots:end\": false\n}",
+		},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := evaluateConditionals("base/test", []byte(testCase.input), facts)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+			continue
+		}
+
+		if string(actual) != testCase.expected {
+			t.Errorf("Expected = %q; got = %q", testCase.expected, actual)
+		}
+	}
+}
+
+func TestEvaluateConditionalsErrors(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"one\n# dots:if group base\ntwo", "base/test:2: dots:if without dots:end"},
+		{"one\n# dots:end", "base/test:2: dots:end without dots:if"},
+		{"# dots:else", "base/test:1: dots:else without dots:if"},
+		{"# dots:if os linux\n# dots:else\n# dots:elif os darwin\n# dots:end", "base/test:3: dots:elif after dots:else"},
+		{"one\ntwo\n# dots:if color blue\n# dots:end", "base/test:3: unknown condition \"color\""},
+		{"# dots:if os\n# dots:end", "base/test:1: expected condition of the form `[not] <kind> <value...>`"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := evaluateConditionals("base/test", []byte(testCase.input), config.Facts{})
+		if err == nil {
+			t.Errorf("Expected error for %q", testCase.input)
+			continue
+		}
+
+		if err.Error() != testCase.expected {
+			t.Errorf("Expected error = %s; got error = %s", testCase.expected, err)
+		}
+	}
+}
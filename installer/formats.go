@@ -0,0 +1,416 @@
+package installer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// parseJSON parses a JSON document, preserving the order of object keys.
+func parseJSON(d []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(d))
+	decoder.UseNumber()
+
+	value, err := decodeJSONValue(decoder)
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+
+	return value, nil
+}
+
+func decodeJSONValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := yaml.MapSlice{}
+
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			object = append(object, yaml.MapItem{Key: key, Value: value})
+		}
+
+		// Consume the closing delimiter
+		_, err := decoder.Token()
+		return object, err
+	case json.Delim('['):
+		list := []interface{}{}
+
+		for decoder.More() {
+			value, err := decodeJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+
+			list = append(list, value)
+		}
+
+		_, err := decoder.Token()
+		return list, err
+	}
+
+	return token, nil
+}
+
+// encodeJSON encodes a document as indented JSON.
+func encodeJSON(document interface{}) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+
+	if err := writeJSONValue(buffer, document, ""); err != nil {
+		return nil, err
+	}
+
+	buffer.WriteByte('\n')
+
+	return buffer.Bytes(), nil
+}
+
+func writeJSONValue(w *bytes.Buffer, value interface{}, indent string) error {
+	nextIndent := indent + "  "
+
+	switch value := value.(type) {
+	case yaml.MapSlice:
+		if len(value) == 0 {
+			w.WriteString("{}")
+			return nil
+		}
+
+		w.WriteString("{\n")
+
+		for i, item := range value {
+			key, err := json.Marshal(fmt.Sprint(item.Key))
+			if err != nil {
+				return err
+			}
+
+			w.WriteString(nextIndent)
+			w.Write(key)
+			w.WriteString(": ")
+
+			if err := writeJSONValue(w, item.Value, nextIndent); err != nil {
+				return err
+			}
+
+			if i != len(value)-1 {
+				w.WriteByte(',')
+			}
+			w.WriteByte('\n')
+		}
+
+		w.WriteString(indent + "}")
+	case []interface{}:
+		if len(value) == 0 {
+			w.WriteString("[]")
+			return nil
+		}
+
+		w.WriteString("[\n")
+
+		for i, item := range value {
+			w.WriteString(nextIndent)
+
+			if err := writeJSONValue(w, item, nextIndent); err != nil {
+				return err
+			}
+
+			if i != len(value)-1 {
+				w.WriteByte(',')
+			}
+			w.WriteByte('\n')
+		}
+
+		w.WriteString(indent + "]")
+	default:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		w.Write(data)
+	}
+
+	return nil
+}
+
+// parseYAML parses a YAML document, preserving the order of map keys.
+func parseYAML(d []byte) (interface{}, error) {
+	var document interface{}
+
+	// Unmarshalling into a MapSlice ensures all nested maps will also be
+	// decoded as MapSlices. Documents which are not maps are decoded normally.
+	mapDocument := yaml.MapSlice{}
+	if err := yaml.Unmarshal(d, &mapDocument); err == nil {
+		return mapDocument, nil
+	}
+
+	if err := yaml.Unmarshal(d, &document); err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+// encodeYAML encodes a document as YAML.
+func encodeYAML(document interface{}) ([]byte, error) {
+	return yaml.Marshal(document)
+}
+
+// parseTOML parses a TOML document. Keys are ordered as they appear in the
+// document.
+func parseTOML(d []byte) (interface{}, error) {
+	document := map[string]interface{}{}
+
+	metadata, err := toml.Decode(string(d), &document)
+	if err != nil {
+		return nil, err
+	}
+
+	order := map[string]int{}
+
+	for i, key := range metadata.Keys() {
+		if _, ok := order[key.String()]; !ok {
+			order[key.String()] = i
+		}
+	}
+
+	return orderTOMLValue(document, "", order), nil
+}
+
+// orderTOMLValue converts TOML maps into MapSlices ordered by the position of
+// each key within the document.
+func orderTOMLValue(value interface{}, path string, order map[string]int) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+
+		for key := range value {
+			keys = append(keys, key)
+		}
+
+		keyPath := func(key string) string {
+			if path == "" {
+				return toml.Key{key}.String()
+			}
+
+			return path + "." + toml.Key{key}.String()
+		}
+
+		sort.SliceStable(keys, func(i, j int) bool {
+			return order[keyPath(keys[i])] < order[keyPath(keys[j])]
+		})
+
+		ordered := yaml.MapSlice{}
+
+		for _, key := range keys {
+			ordered = append(ordered, yaml.MapItem{
+				Key:   key,
+				Value: orderTOMLValue(value[key], keyPath(key), order),
+			})
+		}
+
+		return ordered
+	case []map[string]interface{}:
+		list := make([]interface{}, len(value))
+
+		for i, item := range value {
+			list[i] = orderTOMLValue(item, path, order)
+		}
+
+		return list
+	case []interface{}:
+		list := make([]interface{}, len(value))
+
+		for i, item := range value {
+			list[i] = orderTOMLValue(item, path, order)
+		}
+
+		return list
+	}
+
+	return value
+}
+
+// encodeTOML encodes a document as TOML. The TOML encoder does not preserve
+// the order of keys.
+func encodeTOML(document interface{}) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+
+	encoder := toml.NewEncoder(buffer)
+	encoder.Indent = ""
+
+	if err := encoder.Encode(unorderValue(document)); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// unorderValue converts MapSlices back into maps.
+func unorderValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case yaml.MapSlice:
+		m := map[string]interface{}{}
+
+		for _, item := range value {
+			m[fmt.Sprint(item.Key)] = unorderValue(item.Value)
+		}
+
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(value))
+		tables := make([]map[string]interface{}, 0, len(value))
+
+		for i, item := range value {
+			list[i] = unorderValue(item)
+
+			if table, ok := list[i].(map[string]interface{}); ok {
+				tables = append(tables, table)
+			}
+		}
+
+		// Lists made entirely of tables are encoded as an array of tables
+		if len(value) > 0 && len(tables) == len(value) {
+			return tables
+		}
+
+		return list
+	}
+
+	return value
+}
+
+// parseINI parses an INI document. Keys before the first section are stored
+// at the top level of the document, while sections are stored as maps.
+// Comments are not preserved. Repeated keys within a section, and sections
+// named after a top level key, are rejected.
+func parseINI(d []byte) (interface{}, error) {
+	document := yaml.MapSlice{}
+
+	// section is the index of the current section within the document. Keys
+	// are added to the top level of the document until a section is found.
+	section := -1
+
+	scanner := bufio.NewScanner(bytes.NewReader(d))
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, fmt.Errorf("line %d: unterminated section header", lineNumber)
+			}
+
+			name := strings.TrimSpace(line[1 : len(line)-1])
+
+			section = indexOfKey(document, name)
+			if section == -1 {
+				document = append(document, yaml.MapItem{Key: name, Value: yaml.MapSlice{}})
+				section = len(document) - 1
+			}
+
+			if _, ok := document[section].Value.(yaml.MapSlice); !ok {
+				return nil, fmt.Errorf("line %d: section %q conflicts with key", lineNumber, name)
+			}
+
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNumber)
+		}
+
+		item := yaml.MapItem{
+			Key:   strings.TrimSpace(parts[0]),
+			Value: strings.TrimSpace(parts[1]),
+		}
+
+		keys := document
+		if section != -1 {
+			keys = document[section].Value.(yaml.MapSlice)
+		}
+
+		// Keys with multiple values, such as those of a gitconfig, cannot be
+		// told apart once merged.
+		if indexOfKey(keys, item.Key) != -1 {
+			return nil, fmt.Errorf("line %d: repeated key %q, keys with multiple values cannot be merged", lineNumber, item.Key)
+		}
+
+		if section == -1 {
+			document = append(document, item)
+			continue
+		}
+
+		document[section].Value = append(keys, item)
+	}
+
+	return document, scanner.Err()
+}
+
+// encodeINI encodes a document as INI. Top level keys are written before any
+// sections.
+func encodeINI(document interface{}) ([]byte, error) {
+	root, ok := document.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("INI document must be a map")
+	}
+
+	buffer := bytes.NewBuffer(nil)
+	sections := yaml.MapSlice{}
+
+	for _, item := range root {
+		if _, ok := item.Value.(yaml.MapSlice); ok {
+			sections = append(sections, item)
+			continue
+		}
+
+		fmt.Fprintf(buffer, "%v = %v\n", item.Key, item.Value)
+	}
+
+	for i, section := range sections {
+		if i != 0 || buffer.Len() != 0 {
+			buffer.WriteByte('\n')
+		}
+
+		fmt.Fprintf(buffer, "[%v]\n", section.Key)
+
+		for _, item := range section.Value.(yaml.MapSlice) {
+			fmt.Fprintf(buffer, "%v = %v\n", item.Key, item.Value)
+		}
+	}
+
+	return buffer.Bytes(), nil
+}
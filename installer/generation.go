@@ -0,0 +1,680 @@
+package installer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.evanpurkhiser.com/dots/config"
+)
+
+// GenerationsPath returns the directory generations are stored in, which
+// lives along side the lockfile.
+func GenerationsPath(config *config.SourceConfig) string {
+	return filepath.Join(filepath.Dir(config.LockfilePath), "generations")
+}
+
+// objectsPath returns the directory the contents of files recorded in
+// generations, and the merge bases of installed dotfiles, are stored in, named
+// by their hash.
+func objectsPath(config *config.SourceConfig) string {
+	return filepath.Join(GenerationsPath(config), "objects")
+}
+
+// A Generation records the state of the installed dotfiles after an install,
+// such that it may be reinstalled exactly, even once the source tree has
+// changed.
+type Generation struct {
+	// Number identifies the generation. Generations are numbered in the
+	// order they were recorded.
+	Number int `json:"number"`
+
+	// Created is the time the generation was recorded.
+	Created time.Time `json:"created"`
+
+	// Revision is the revision of the source repository the generation was
+	// installed from, if the source path is a git repository. A dirty working
+	// tree is suffixed with `-dirty`.
+	Revision string `json:"revision,omitempty"`
+
+	// RollbackOf is the number of the generation that was reinstalled to
+	// create this generation.
+	RollbackOf int `json:"rollback_of,omitempty"`
+
+	// Lockfile is the lockfile written by the install.
+	Lockfile config.SourceLockfile `json:"lockfile"`
+
+	// Files lists every file installed by the generation.
+	Files []GenerationFile `json:"files"`
+
+	// Scripts lists the install scripts of the installed dotfiles.
+	Scripts []GenerationScript `json:"scripts,omitempty"`
+}
+
+// GenerationFile records an installed file.
+type GenerationFile struct {
+	// Path is the absolute path of the installed file.
+	Path string `json:"path"`
+
+	// Hash is the sha256 of the file contents. The contents are stored in the
+	// generation objects directory under the hash.
+	Hash string `json:"hash,omitempty"`
+
+	// Mode is the permissions of the file.
+	Mode os.FileMode `json:"mode,omitempty"`
+
+	// LinkTarget is the target of the file when it is a symlink.
+	LinkTarget string `json:"link_target,omitempty"`
+}
+
+// GenerationScript records an install script along with the files which
+// cause it to be executed.
+type GenerationScript struct {
+	// Source is the path of the script within the source tree.
+	Source string `json:"source"`
+
+	// Hash is the sha256 of the script contents.
+	Hash string `json:"hash"`
+
+	// Directory is the absolute path the script is executed within.
+	Directory string `json:"directory"`
+
+	// RequiredBy lists the absolute paths of the files the script is run for.
+	RequiredBy []string `json:"required_by"`
+}
+
+// sameState indicates if the generations record the same installed state. The
+// order dotfiles are listed in the lockfile depends on the order they were
+// installed in, which is not part of the state.
+func (g *Generation) sameState(other *Generation) bool {
+	return reflect.DeepEqual(sortedLockfile(g.Lockfile), sortedLockfile(other.Lockfile)) &&
+		reflect.DeepEqual(g.Files, other.Files) &&
+		reflect.DeepEqual(g.Scripts, other.Scripts)
+}
+
+// sortedLockfile returns a copy of the lockfile with its lists of installed
+// dotfiles sorted.
+func sortedLockfile(lockfile config.SourceLockfile) config.SourceLockfile {
+	lockfile.InstalledFiles = slices.Sorted(slices.Values(lockfile.InstalledFiles))
+	lockfile.InstalledLinks = slices.Sorted(slices.Values(lockfile.InstalledLinks))
+
+	targets := map[string]config.InstalledTarget{}
+
+	for name, target := range lockfile.InstalledTargets {
+		target.Files = slices.Sorted(slices.Values(target.Files))
+		targets[name] = target
+	}
+
+	lockfile.InstalledTargets = targets
+
+	return lockfile
+}
+
+// file returns the recorded file at the path.
+func (g *Generation) file(path string) *GenerationFile {
+	for i := range g.Files {
+		if g.Files[i].Path == path {
+			return &g.Files[i]
+		}
+	}
+
+	return nil
+}
+
+// ListGenerations returns all recorded generations, oldest first.
+func ListGenerations(config *config.SourceConfig) ([]*Generation, error) {
+	entries, err := os.ReadDir(GenerationsPath(config))
+	if os.IsNotExist(err) {
+		return []*Generation{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	generations := []*Generation{}
+
+	for _, entry := range entries {
+		number, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil || entry.IsDir() {
+			continue
+		}
+
+		generation, err := LoadGeneration(config, number)
+		if err != nil {
+			return nil, err
+		}
+
+		generations = append(generations, generation)
+	}
+
+	sort.Slice(generations, func(i, j int) bool {
+		return generations[i].Number < generations[j].Number
+	})
+
+	return generations, nil
+}
+
+// LoadGeneration reads the numbered generation.
+func LoadGeneration(config *config.SourceConfig, number int) (*Generation, error) {
+	path := filepath.Join(GenerationsPath(config), fmt.Sprintf("%d.json", number))
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("generation %d does not exist", number)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	generation := &Generation{}
+
+	if err := json.NewDecoder(file).Decode(generation); err != nil {
+		return nil, fmt.Errorf("generation %d is invalid: %s", number, err)
+	}
+
+	return generation, nil
+}
+
+// RecordGeneration records the state of the installed dotfiles, as written to
+// the lockfile by FinalizeInstall, as a new generation. The contents of every
+// installed file and install script are stored, so the generation can be
+// reinstalled without the source tree. Installed files which were not part of
+// the install, such as those excluded by a filter, keep the install scripts
+// recorded for them by the latest generation. No generation is recorded when
+// the state is unchanged from the latest generation, which is returned
+// instead.
+//
+// The stored contents are plain copies of the installed files, including any
+// secrets they contain, and are kept until pruned with PruneGenerations.
+func RecordGeneration(install PreparedInstall, config InstallConfig) (*Generation, error) {
+	generation := &Generation{
+		Revision: sourceRevision(config.SourceConfig.SourcePath),
+		Lockfile: *config.SourceLockfile,
+		Files:    []GenerationFile{},
+	}
+
+	for _, path := range installedFiles(config.SourceConfig, config.SourceLockfile) {
+		file, data, err := readGenerationFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		// Files removed since being installed are not recorded
+		if file == nil {
+			continue
+		}
+
+		if err := storeObject(config.SourceConfig, file.Hash, data); err != nil {
+			return nil, err
+		}
+
+		generation.Files = append(generation.Files, *file)
+	}
+
+	sort.Slice(generation.Files, func(i, j int) bool {
+		return generation.Files[i].Path < generation.Files[j].Path
+	})
+
+	generations, err := ListGenerations(config.SourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	scripts := map[string]*GenerationScript{}
+
+	if len(generations) > 0 {
+		installing := map[string]bool{}
+
+		for _, dotfile := range install.Dotfiles {
+			installing[config.installPath(dotfile.Dotfile)] = true
+		}
+
+		for _, script := range generations[len(generations)-1].Scripts {
+			requiredBy := []string{}
+
+			for _, path := range script.RequiredBy {
+				if !installing[path] && generation.file(path) != nil {
+					requiredBy = append(requiredBy, path)
+				}
+			}
+
+			if len(requiredBy) > 0 {
+				script.RequiredBy = requiredBy
+				scripts[script.Source] = &script
+			}
+		}
+	}
+
+	for _, script := range install.InstallScripts {
+		if script.PrepareError != nil || !script.Executable {
+			continue
+		}
+
+		data, err := os.ReadFile(script.FilePath)
+		if err != nil {
+			return nil, err
+		}
+
+		hash := hashContents(data)
+
+		if err := storeObject(config.SourceConfig, hash, data); err != nil {
+			return nil, err
+		}
+
+		source := strings.TrimPrefix(script.FilePath, config.SourceConfig.SourcePath+separator)
+
+		requiredBy := []string{}
+		if previous, ok := scripts[source]; ok {
+			requiredBy = previous.RequiredBy
+		}
+
+		for _, dotfile := range script.RequiredBy {
+			requiredBy = append(requiredBy, config.installPath(dotfile.Dotfile))
+		}
+
+		sort.Strings(requiredBy)
+
+		scripts[source] = &GenerationScript{
+			Source:     source,
+			Hash:       hash,
+			Directory:  config.targetPath(script.Target) + separator + script.Path,
+			RequiredBy: slices.Compact(requiredBy),
+		}
+	}
+
+	for _, script := range scripts {
+		generation.Scripts = append(generation.Scripts, *script)
+	}
+
+	sort.Slice(generation.Scripts, func(i, j int) bool {
+		return generation.Scripts[i].Source < generation.Scripts[j].Source
+	})
+
+	if len(generations) > 0 {
+		latest := generations[len(generations)-1]
+
+		if latest.sameState(generation) {
+			return latest, nil
+		}
+	}
+
+	return generation, writeGeneration(config.SourceConfig, generation, generations)
+}
+
+// RecordRollback records the reinstall of the generation as a new generation
+// with the same state.
+func RecordRollback(generation *Generation, config InstallConfig) (*Generation, error) {
+	generations, err := ListGenerations(config.SourceConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	rollback := *generation
+	rollback.RollbackOf = generation.Number
+
+	return &rollback, writeGeneration(config.SourceConfig, &rollback, generations)
+}
+
+// writeGeneration numbers the generation after the existing generations and
+// writes it.
+func writeGeneration(config *config.SourceConfig, generation *Generation, generations []*Generation) error {
+	generation.Number = 1
+	generation.Created = time.Now()
+
+	if len(generations) > 0 {
+		generation.Number = generations[len(generations)-1].Number + 1
+	}
+
+	data, err := json.MarshalIndent(generation, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(GenerationsPath(config), 0777); err != nil {
+		return err
+	}
+
+	path := filepath.Join(GenerationsPath(config), fmt.Sprintf("%d.json", generation.Number))
+
+	return writeFile(path, bytes.NewReader(data), 0644)
+}
+
+// PruneGenerations removes all but the latest kept generations. Stored objects
+// which are no longer referenced by a remaining generation, nor by the merge
+// bases of the lockfile, are removed along with them. The number of removed
+// generations is returned.
+func PruneGenerations(conf *config.SourceConfig, lockfile *config.SourceLockfile, keep int) (int, error) {
+	generations, err := ListGenerations(conf)
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := generations[:max(len(generations)-keep, 0)]
+	kept := generations[len(pruned):]
+
+	for _, generation := range pruned {
+		path := filepath.Join(GenerationsPath(conf), fmt.Sprintf("%d.json", generation.Number))
+
+		if err := os.Remove(path); err != nil {
+			return 0, err
+		}
+	}
+
+	referenced := map[string]bool{}
+
+	reference := func(lockfile config.SourceLockfile) {
+		for _, state := range lockfile.InstalledState {
+			referenced[state.Hash] = true
+			referenced[state.Base] = true
+		}
+	}
+
+	reference(*lockfile)
+
+	for _, generation := range kept {
+		reference(generation.Lockfile)
+
+		for _, file := range generation.Files {
+			referenced[file.Hash] = true
+		}
+
+		for _, script := range generation.Scripts {
+			referenced[script.Hash] = true
+		}
+	}
+
+	entries, err := os.ReadDir(objectsPath(conf))
+	if os.IsNotExist(err) {
+		return len(pruned), nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		if referenced[entry.Name()] {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(objectsPath(conf), entry.Name())); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(pruned), nil
+}
+
+// A GenerationChange is a file which differs from the generation being
+// reinstalled.
+type GenerationChange struct {
+	// Path is the absolute path of the file.
+	Path string
+
+	// Removed indicates the file is not part of the generation and will be
+	// removed.
+	Removed bool
+
+	// InstallError represents an error that occurred reinstalling the file.
+	InstallError error
+}
+
+// GenerationChanges determines the files which differ from the generation.
+// Files installed according to the lockfile which are not part of the
+// generation are removed.
+func GenerationChanges(generation *Generation, config InstallConfig) ([]*GenerationChange, error) {
+	changes := []*GenerationChange{}
+	recorded := map[string]bool{}
+
+	for _, file := range generation.Files {
+		recorded[file.Path] = true
+
+		existing, _, err := readGenerationFile(file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		if existing != nil && *existing == file {
+			continue
+		}
+
+		changes = append(changes, &GenerationChange{Path: file.Path})
+	}
+
+	for _, path := range installedFiles(config.SourceConfig, config.SourceLockfile) {
+		if recorded[path] {
+			continue
+		}
+
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		}
+
+		changes = append(changes, &GenerationChange{Path: path, Removed: true})
+	}
+
+	return changes, nil
+}
+
+// InstallGeneration reinstalls the changed files of the generation from their
+// stored contents. Each change records any error installing it.
+func InstallGeneration(generation *Generation, changes []*GenerationChange, config InstallConfig) {
+	for _, change := range changes {
+		change.InstallError = installGenerationFile(generation, change, config)
+	}
+}
+
+// installGenerationFile reinstalls a single changed file of the generation.
+func installGenerationFile(generation *Generation, change *GenerationChange, config InstallConfig) error {
+	if err := config.backup(change.Path); err != nil {
+		return err
+	}
+
+	if change.Removed {
+		return os.Remove(change.Path)
+	}
+
+	file := generation.file(change.Path)
+
+	if err := os.MkdirAll(filepath.Dir(file.Path), config.SourceConfig.DirectoryFileMode()); err != nil {
+		return err
+	}
+
+	if file.LinkTarget != "" {
+		return installSymlink(file.Path, file.LinkTarget)
+	}
+
+	object, err := os.Open(filepath.Join(objectsPath(config.SourceConfig), file.Hash))
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	return writeFile(file.Path, object, file.Mode)
+}
+
+// RunGenerationScripts executes the stored install scripts of the generation
+// which are required by a changed file (unless ForceReinstall is enabled, in
+// which case *all* scripts will be run).
+func RunGenerationScripts(generation *Generation, changes []*GenerationChange, config InstallConfig) error {
+	changed := map[string]bool{}
+	for _, change := range changes {
+		changed[change.Path] = true
+	}
+
+	failed := []string{}
+
+	for _, script := range generation.Scripts {
+		required := config.ForceReinstall
+
+		for _, path := range script.RequiredBy {
+			required = required || changed[path]
+		}
+
+		if !required {
+			continue
+		}
+
+		if err := runGenerationScript(script, config); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", script.Source, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("install scripts failed: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// runGenerationScript copies the stored script to a temporary executable file
+// within the generations directory and executes it.
+func runGenerationScript(script GenerationScript, config InstallConfig) error {
+	object, err := os.Open(filepath.Join(objectsPath(config.SourceConfig), script.Hash))
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	// The system temporary directory may be mounted without execution
+	temp, err := os.CreateTemp(GenerationsPath(config.SourceConfig), "script-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = io.Copy(temp, object)
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(temp.Name(), 0700); err != nil {
+		return err
+	}
+
+	return scriptCommand(temp.Name(), script.Directory, config).Run()
+}
+
+// installedFiles returns the absolute paths of every file and link installed
+// according to the lockfile.
+func installedFiles(config *config.SourceConfig, lockfile *config.SourceLockfile) []string {
+	paths := []string{}
+
+	for _, path := range lockfile.InstalledFiles {
+		paths = append(paths, config.InstallPath+separator+path)
+	}
+
+	targets := make([]string, 0, len(lockfile.InstalledTargets))
+	for name := range lockfile.InstalledTargets {
+		targets = append(targets, name)
+	}
+
+	sort.Strings(targets)
+
+	for _, name := range targets {
+		target := lockfile.InstalledTargets[name]
+
+		for _, path := range target.Files {
+			paths = append(paths, target.Path+separator+path)
+		}
+	}
+
+	return append(paths, lockfile.InstalledLinks...)
+}
+
+// readGenerationFile describes the installed file at the path, returning its
+// contents. Nil is returned when nothing is installed at the path.
+func readGenerationFile(path string) (*GenerationFile, []byte, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if info.IsDir() {
+		return nil, nil, nil
+	}
+
+	if isSymlink(info) {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return &GenerationFile{Path: path, LinkTarget: target}, nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file := &GenerationFile{
+		Path: path,
+		Hash: hashContents(data),
+		Mode: info.Mode() & os.ModePerm,
+	}
+
+	return file, data, nil
+}
+
+// storeObject stores the contents under the hash in the objects directory,
+// unless already stored. Symlinks have no contents to store.
+func storeObject(config *config.SourceConfig, hash string, data []byte) error {
+	if hash == "" {
+		return nil
+	}
+
+	path := filepath.Join(objectsPath(config), hash)
+
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(objectsPath(config), 0777); err != nil {
+		return err
+	}
+
+	return writeFile(path, bytes.NewReader(data), 0600)
+}
+
+// sourceRevision returns the revision of the git repository at the source
+// path. An empty string is returned when the source path is not a repository.
+func sourceRevision(sourcePath string) string {
+	revision, err := exec.Command("git", "-C", sourcePath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+
+	status, err := exec.Command("git", "-C", sourcePath, "status", "--porcelain").Output()
+	if err != nil {
+		return ""
+	}
+
+	if len(bytes.TrimSpace(status)) > 0 {
+		return strings.TrimSpace(string(revision)) + "-dirty"
+	}
+
+	return strings.TrimSpace(string(revision))
+}
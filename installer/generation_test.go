@@ -0,0 +1,256 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+func TestGenerationRollback(t *testing.T) {
+	root := t.TempDir()
+
+	sourceConfig := &config.SourceConfig{
+		SourcePath:   filepath.Join(root, "source"),
+		InstallPath:  filepath.Join(root, "home"),
+		LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+	}
+
+	lockfile := &config.SourceLockfile{
+		InstalledFiles: []string{"bashrc", "vimrc"},
+		InstalledLinks: []string{filepath.Join(root, "link")},
+	}
+
+	installConfig := InstallConfig{
+		SourceConfig:   sourceConfig,
+		SourceLockfile: lockfile,
+	}
+
+	path := func(name string) string {
+		return filepath.Join(sourceConfig.InstallPath, name)
+	}
+
+	os.MkdirAll(sourceConfig.SourcePath, 0755)
+	os.MkdirAll(sourceConfig.InstallPath, 0755)
+
+	os.WriteFile(path("bashrc"), []byte("bashrc v1\n"), 0600)
+	os.WriteFile(path("vimrc"), []byte("vimrc v1\n"), 0644)
+	os.Symlink("home/bashrc", filepath.Join(root, "link"))
+
+	scriptPath := filepath.Join(sourceConfig.SourcePath, "bashrc.install")
+	os.WriteFile(scriptPath, []byte("#!/bin/sh\necho v1 >> ../script.log\n"), 0755)
+
+	install := PreparedInstall{
+		InstallScripts: []*InstallScript{{
+			RequiredBy: []*PreparedDotfile{{Dotfile: &resolver.Dotfile{Path: "bashrc"}}},
+			Path:       ".",
+			FilePath:   scriptPath,
+			Executable: true,
+		}},
+	}
+
+	first, err := RecordGeneration(install, installConfig)
+	if err != nil {
+		t.Fatalf("Failed to record generation: %s", err)
+	}
+
+	if first.Number != 1 || len(first.Files) != 3 || len(first.Scripts) != 1 {
+		t.Fatalf("Expected generation 1 with 3 files and 1 script; got = %+v", first)
+	}
+
+	// An unchanged state records no new generation
+	if unchanged, _ := RecordGeneration(install, installConfig); unchanged.Number != 1 {
+		t.Errorf("Expected unchanged generation number = 1; got = %d", unchanged.Number)
+	}
+
+	// Install a second generation, which replaces the bashrc, removes the
+	// vimrc and changes the install script.
+	os.WriteFile(path("bashrc"), []byte("bashrc v2\n"), 0644)
+	os.Remove(path("vimrc"))
+	os.WriteFile(scriptPath, []byte("#!/bin/sh\necho v2 >> ../script.log\n"), 0755)
+
+	lockfile.InstalledFiles = []string{"bashrc"}
+
+	if second, _ := RecordGeneration(install, installConfig); second.Number != 2 {
+		t.Fatalf("Expected generation number = 2; got = %d", second.Number)
+	}
+
+	generations, err := ListGenerations(sourceConfig)
+	if err != nil || len(generations) != 2 {
+		t.Fatalf("Expected 2 generations; got = %d (%v)", len(generations), err)
+	}
+
+	changes, err := GenerationChanges(first, installConfig)
+	if err != nil {
+		t.Fatalf("Failed to determine changes: %s", err)
+	}
+
+	if len(changes) != 2 || changes[0].Path != path("bashrc") || changes[1].Path != path("vimrc") {
+		t.Fatalf("Expected bashrc and vimrc to change; got = %+v", changes)
+	}
+
+	InstallGeneration(first, changes, installConfig)
+
+	for _, change := range changes {
+		if change.InstallError != nil {
+			t.Fatalf("Failed to install %s: %s", change.Path, change.InstallError)
+		}
+	}
+
+	if err := RunGenerationScripts(first, changes, installConfig); err != nil {
+		t.Fatalf("Failed to run scripts: %s", err)
+	}
+
+	if data, _ := os.ReadFile(path("bashrc")); string(data) != "bashrc v1\n" {
+		t.Errorf("Expected bashrc content = %q; got = %q", "bashrc v1\n", data)
+	}
+
+	if info, _ := os.Stat(path("bashrc")); info.Mode()&os.ModePerm != 0600 {
+		t.Errorf("Expected bashrc mode = %#o; got = %#o", 0600, info.Mode()&os.ModePerm)
+	}
+
+	if data, _ := os.ReadFile(path("vimrc")); string(data) != "vimrc v1\n" {
+		t.Errorf("Expected vimrc content = %q; got = %q", "vimrc v1\n", data)
+	}
+
+	// The script of the first generation is run, not the current script
+	if data, _ := os.ReadFile(filepath.Join(root, "script.log")); string(data) != "v1\n" {
+		t.Errorf("Expected script output = %q; got = %q", "v1\n", data)
+	}
+
+	rollback, err := RecordRollback(first, installConfig)
+	if err != nil || rollback.Number != 3 || rollback.RollbackOf != 1 {
+		t.Errorf("Expected generation 3 rolling back to 1; got = %+v (%v)", rollback, err)
+	}
+}
+
+func TestPruneGenerations(t *testing.T) {
+	root := t.TempDir()
+
+	sourceConfig := &config.SourceConfig{
+		SourcePath:   filepath.Join(root, "source"),
+		InstallPath:  filepath.Join(root, "home"),
+		LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+	}
+
+	lockfile := &config.SourceLockfile{InstalledFiles: []string{"bashrc"}}
+
+	installConfig := InstallConfig{
+		SourceConfig:   sourceConfig,
+		SourceLockfile: lockfile,
+	}
+
+	bashrcPath := filepath.Join(sourceConfig.InstallPath, "bashrc")
+
+	os.MkdirAll(sourceConfig.SourcePath, 0755)
+	os.MkdirAll(sourceConfig.InstallPath, 0755)
+
+	for _, content := range []string{"v1\n", "v2\n", "v3\n"} {
+		os.WriteFile(bashrcPath, []byte(content), 0644)
+
+		if _, err := RecordGeneration(PreparedInstall{}, installConfig); err != nil {
+			t.Fatalf("Failed to record generation: %s", err)
+		}
+	}
+
+	// The merge base of the installed bashrc is still needed
+	base := hashContents([]byte("v1\n"))
+	lockfile.InstalledState = map[string]config.FileState{bashrcPath: {Hash: hashContents([]byte("v3\n")), Base: base}}
+
+	removed, err := PruneGenerations(sourceConfig, lockfile, 1)
+	if err != nil || removed != 2 {
+		t.Fatalf("Expected 2 generations removed; got = %d (%v)", removed, err)
+	}
+
+	generations, _ := ListGenerations(sourceConfig)
+	if len(generations) != 1 || generations[0].Number != 3 {
+		t.Fatalf("Expected only generation 3 to be kept; got = %+v", generations)
+	}
+
+	objects := map[string]bool{
+		hashContents([]byte("v1\n")): true,
+		hashContents([]byte("v2\n")): false,
+		hashContents([]byte("v3\n")): true,
+	}
+
+	for hash, kept := range objects {
+		_, err := os.Stat(filepath.Join(objectsPath(sourceConfig), hash))
+		if exists := err == nil; exists != kept {
+			t.Errorf("Expected object %.12s kept = %t", hash, kept)
+		}
+	}
+}
+
+func TestGenerationFilteredInstall(t *testing.T) {
+	root := t.TempDir()
+
+	sourceConfig := &config.SourceConfig{
+		SourcePath:   filepath.Join(root, "source"),
+		InstallPath:  filepath.Join(root, "home"),
+		LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+	}
+
+	lockfile := &config.SourceLockfile{InstalledFiles: []string{"a", "b"}}
+
+	installConfig := InstallConfig{
+		SourceConfig:   sourceConfig,
+		SourceLockfile: lockfile,
+	}
+
+	os.MkdirAll(filepath.Join(sourceConfig.SourcePath, "base"), 0755)
+	os.MkdirAll(sourceConfig.InstallPath, 0755)
+
+	dotfiles := map[string]*PreparedDotfile{}
+	scripts := map[string]*InstallScript{}
+
+	for _, name := range []string{"a", "b"} {
+		os.WriteFile(filepath.Join(sourceConfig.InstallPath, name), []byte(name+"\n"), 0644)
+
+		scriptPath := filepath.Join(sourceConfig.SourcePath, "base", name+".install")
+		os.WriteFile(scriptPath, []byte("#!/bin/sh\n"), 0755)
+
+		dotfiles[name] = &PreparedDotfile{Dotfile: &resolver.Dotfile{Path: name}}
+		scripts[name] = &InstallScript{
+			RequiredBy: []*PreparedDotfile{dotfiles[name]},
+			Path:       ".",
+			FilePath:   scriptPath,
+			Executable: true,
+		}
+	}
+
+	full := PreparedInstall{
+		Dotfiles:       []*PreparedDotfile{dotfiles["a"], dotfiles["b"]},
+		InstallScripts: []*InstallScript{scripts["a"], scripts["b"]},
+	}
+
+	if _, err := RecordGeneration(full, installConfig); err != nil {
+		t.Fatalf("Failed to record generation: %s", err)
+	}
+
+	// Only b is installed, the lockfile lists it first
+	os.WriteFile(filepath.Join(sourceConfig.InstallPath, "b"), []byte("b v2\n"), 0644)
+	lockfile.InstalledFiles = []string{"b", "a"}
+
+	filtered := PreparedInstall{
+		Dotfiles:       []*PreparedDotfile{dotfiles["b"]},
+		InstallScripts: []*InstallScript{scripts["b"]},
+	}
+
+	second, err := RecordGeneration(filtered, installConfig)
+	if err != nil {
+		t.Fatalf("Failed to record generation: %s", err)
+	}
+
+	if second.Number != 2 || len(second.Scripts) != 2 {
+		t.Fatalf("Expected generation 2 keeping both scripts; got = %+v", second)
+	}
+
+	// A full install of the same state records no new generation
+	lockfile.InstalledFiles = []string{"a", "b"}
+
+	if unchanged, _ := RecordGeneration(full, installConfig); unchanged.Number != 2 {
+		t.Errorf("Expected unchanged generation number = 2; got = %d", unchanged.Number)
+	}
+}
@@ -1,19 +1,36 @@
 package installer
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"go.evanpurkhiser.com/dots/config"
 	"go.evanpurkhiser.com/dots/events"
+	"go.evanpurkhiser.com/dots/resolver"
 )
 
 const separator = string(os.PathSeparator)
 
-// directoryMode is the mode used to create directories for installed dotfiles.
-const directoryMode = 0755
+// ConflictMode specifies how dotfiles which have been modified since they were
+// last installed are handled.
+type ConflictMode string
+
+// Available conflict modes. By default locally modified dotfiles are skipped
+// and reported as conflicts, unless their sources have also changed and the
+// modifications can be merged. They may instead be overwritten, overwritten
+// after saving the local version in the backup run, or kept for the install.
+const (
+	ConflictSkip   ConflictMode = ""
+	ConflictForce  ConflictMode = "force"
+	ConflictBackup ConflictMode = "backup"
+	ConflictKeep   ConflictMode = "keep"
+)
 
 // InstallConfig represents configuration options available for installing
 // a single or set of dotfiles.
@@ -25,6 +42,27 @@ type InstallConfig struct {
 	// overriding the configuration in the SourceConfig.
 	OverrideInstallPath string
 
+	// OverrideTargetPaths maps install target names to a path to install the
+	// dotfiles of the target at, overriding the configured target path.
+	OverrideTargetPaths map[string]string
+
+	// OverrideLinkPath specifies a directory to install managed links within,
+	// rather than at their absolute path.
+	OverrideLinkPath string
+
+	// Backups saves the previous content of files before they are
+	// overwritten or removed. No backups are made when nil.
+	Backups *BackupRun
+
+	// Conflicts specifies how dotfiles modified since they were last
+	// installed are handled.
+	Conflicts ConflictMode
+
+	// ConflictMarkers installs merges which have conflicts, with the
+	// conflicting lines delimited by conflict markers. Otherwise dotfiles
+	// which cannot be merged are left untouched.
+	ConflictMarkers bool
+
 	// ForceReinstall installs the dotfile even if the dotfile has not been
 	// changed from its source. This implies that install scripts will be run.
 	ForceReinstall bool
@@ -35,6 +73,39 @@ type InstallConfig struct {
 	EventLogger chan<- events.Event
 }
 
+// targetPath returns the directory dotfiles of the named install target are
+// installed into.
+func (c InstallConfig) targetPath(target string) string {
+	if target == "" && c.OverrideInstallPath != "" {
+		return c.OverrideInstallPath
+	}
+
+	if path, ok := c.OverrideTargetPaths[target]; ok {
+		return path
+	}
+
+	return c.SourceLockfile.TargetPath(*c.SourceConfig, target)
+}
+
+// backup saves the file at the path before it is overwritten or removed, when
+// backups are enabled.
+func (c InstallConfig) backup(path string) error {
+	if c.Backups == nil {
+		return nil
+	}
+
+	return c.Backups.Save(path)
+}
+
+// installPath returns the path the dotfile is installed at.
+func (c InstallConfig) installPath(dotfile *resolver.Dotfile) string {
+	if dotfile.ManagedLink {
+		return c.OverrideLinkPath + dotfile.Path
+	}
+
+	return c.targetPath(dotfile.InstallTarget) + separator + dotfile.Path
+}
+
 // InstalledDotfile is a represents of the dotfile *after* it has been
 // installed into the configuration directory.
 type InstalledDotfile struct {
@@ -67,6 +138,10 @@ func WillInstallDotfile(dotfile *PreparedDotfile, config InstallConfig) bool {
 		return false
 	}
 
+	if IsSkippedConflict(dotfile, config) {
+		return false
+	}
+
 	if !dotfile.IsChanged() && !config.ForceReinstall {
 		return false
 	}
@@ -74,6 +149,29 @@ func WillInstallDotfile(dotfile *PreparedDotfile, config InstallConfig) bool {
 	return true
 }
 
+// IsSkippedConflict indicates that the dotfile has been modified since it was
+// last installed and will be left unchanged to keep the modifications.
+func IsSkippedConflict(dotfile *PreparedDotfile, config InstallConfig) bool {
+	if !dotfile.IsConflict() {
+		return false
+	}
+
+	switch config.Conflicts {
+	case ConflictSkip:
+		return !config.mergesDotfile(dotfile)
+	case ConflictKeep:
+		return true
+	}
+
+	return false
+}
+
+// IsMerged indicates that the dotfile will be installed from the merge of its
+// local modifications and the changes to its sources.
+func IsMerged(dotfile *PreparedDotfile, config InstallConfig) bool {
+	return dotfile.PrepareError == nil && config.mergesDotfile(dotfile)
+}
+
 // InstallDotfile is given a prepared dotfile and installation configuration
 // and will perform all the necessary actions to install the file into it's
 // target location.
@@ -82,48 +180,189 @@ func InstallDotfile(dotfile *PreparedDotfile, config InstallConfig) error {
 		return nil
 	}
 
-	installPath := config.SourceConfig.InstallPath + separator + dotfile.Path
+	installRoot := config.targetPath(dotfile.InstallTarget)
+	installPath := config.installPath(dotfile.Dotfile)
+
+	// Removed. Nothing needs to be done if the removed dotfile does not exist.
+	if dotfile.Removed && dotfile.RemovedNull {
+		return nil
+	}
+
+	// The local modifications will be lost, they must be restorable from the
+	// backup run
+	if dotfile.IsConflict() && config.Conflicts == ConflictBackup {
+		if config.Backups == nil {
+			return fmt.Errorf("no backup run to save the local version in")
+		}
 
-	if config.OverrideInstallPath != "" {
-		installPath = config.OverrideInstallPath + separator + dotfile.Path
+		if err := config.backup(installPath); err != nil {
+			return err
+		}
 	}
 
-	// Removed
-	if dotfile.Removed && !dotfile.RemovedNull {
+	if dotfile.Removed {
+		if err := config.backup(installPath); err != nil {
+			return err
+		}
+
 		return os.Remove(installPath)
 	}
 
+	// Managed links are installed outside of any install root
+	if dotfile.ManagedLink {
+		if err := os.MkdirAll(filepath.Dir(installPath), config.SourceConfig.DirectoryFileMode()); err != nil {
+			return err
+		}
+
+		if err := config.backup(installPath); err != nil {
+			return err
+		}
+
+		return installSymlink(installPath, dotfile.LinkTarget)
+	}
+
 	targetMode := dotfile.Permissions.New
 
+	if err := createDirectories(installRoot, dotfile, config.SourceConfig.DirectoryFileMode()); err != nil {
+		return err
+	}
+
 	// Only filemode differs
-	modeChanged := !dotfile.IsNew &&
-		!dotfile.ContentsDiffer && dotfile.Permissions.IsChanged()
+	modeChanged := !dotfile.IsNew && !dotfile.ContentsDiffer &&
+		(dotfile.Permissions.IsChanged() || dotfile.DirectoryPermissionsChanged())
 
-	if modeChanged {
+	if modeChanged && dotfile.Permissions.IsChanged() {
 		return os.Chmod(installPath, targetMode)
 	}
 
-	if err := os.MkdirAll(path.Dir(installPath), directoryMode); err != nil {
+	if modeChanged {
+		return nil
+	}
+
+	if err := config.backup(installPath); err != nil {
 		return err
 	}
 
-	targetOpts := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	if dotfile.IsSymlink() {
+		return installSymlink(installPath, dotfile.LinkTarget)
+	}
+
+	if config.mergesDotfile(dotfile) {
+		return writeFile(installPath, bytes.NewReader(dotfile.Merge.Content), targetMode)
+	}
 
-	target, err := os.OpenFile(installPath, targetOpts, targetMode)
+	source, err := OpenDotfile(dotfile.Dotfile, *config.SourceConfig, *config.SourceLockfile)
 	if err != nil {
 		return err
 	}
-	defer target.Close()
+	defer source.Close()
+
+	return writeFile(installPath, source, targetMode)
+}
 
-	source, err := OpenDotfile(dotfile.Dotfile, *config.SourceConfig)
+// writeFile atomically replaces the file at the path with the contents of the
+// reader. The contents are written to a temporary file in the same directory,
+// which is renamed into place once completely written, so the file is never
+// left partially written. An existing symlink at the path is replaced rather
+// than written through.
+func writeFile(path string, contents io.Reader, mode os.FileMode) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".dots-")
 	if err != nil {
 		return err
 	}
-	defer source.Close()
+	defer os.Remove(temp.Name())
+
+	if _, err := io.Copy(temp, contents); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Chmod(mode); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
 
-	_, err = io.Copy(target, source)
+// tempPath returns an unused path in the same directory as the path, which
+// may be renamed over the path.
+func tempPath(path string) (string, error) {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".dots-")
+	if err != nil {
+		return "", err
+	}
 
-	return err
+	temp.Close()
+
+	return temp.Name(), os.Remove(temp.Name())
+}
+
+// createDirectories creates the install root and the parent directories of the
+// dotfile within the install root. Directories with a mode specified by a file
+// rule are created with, or changed to, that mode. All other directories are
+// created using the default mode.
+func createDirectories(installRoot string, dotfile *PreparedDotfile, defaultMode os.FileMode) error {
+	if err := os.MkdirAll(installRoot, defaultMode); err != nil {
+		return err
+	}
+
+	dirs := []string{}
+
+	for dir := path.Dir(dotfile.Path); dir != "."; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+
+	for _, dir := range dirs {
+		dirPath := installRoot + separator + dir
+		mode, declared := dotfile.DirectoryModes[dir]
+
+		if !declared {
+			mode = defaultMode
+		}
+
+		// Dotfiles are installed concurrently, the directory may be created
+		// by another dotfile at any time.
+		err := os.Mkdir(dirPath, mode)
+
+		if err == nil {
+			// The requested mode is subject to the umask, declared modes are
+			// always applied exactly.
+			if declared {
+				if err := os.Chmod(dirPath, mode); err != nil {
+					return err
+				}
+			}
+
+			continue
+		}
+
+		if !os.IsExist(err) {
+			return err
+		}
+
+		info, err := os.Stat(dirPath)
+		if err != nil {
+			return err
+		}
+
+		if declared && info.Mode()&os.ModePerm != mode {
+			if err := os.Chmod(dirPath, mode); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
 
 // InstallDotfiles asynchronously calls InstalledDotfile on all passed
@@ -169,23 +408,161 @@ func InstallDotfiles(install PreparedInstall, config InstallConfig) InstalledDot
 	return installed
 }
 
-// FinalizeInstall writes the updated lockfile after installation
+// RollbackInstall undoes the changes made by installing the dotfiles, leaving
+// files as they were before the install. Replaced and removed files are
+// restored from their backup, added files are removed, and changed modes are
+// reverted. Dotfiles which failed to install were left unchanged. Directories
+// created during the install are kept.
+func RollbackInstall(installed InstalledDotfiles, config InstallConfig) error {
+	if config.Backups == nil {
+		return fmt.Errorf("backups must be enabled to rollback an install")
+	}
+
+	saved := map[string]bool{}
+	for _, path := range config.Backups.Saved() {
+		saved[path] = true
+	}
+
+	failed := []string{}
+
+	for _, dotfile := range installed {
+		if dotfile.InstallError != nil || !WillInstallDotfile(dotfile.PreparedDotfile, config) {
+			continue
+		}
+
+		installPath := config.installPath(dotfile.Dotfile)
+
+		var err error
+
+		switch {
+		case saved[installPath]:
+			err = RestoreBackup(config.SourceConfig, config.Backups.ID, installPath, nil)
+		case dotfile.IsNew && !dotfile.Removed:
+			err = os.Remove(installPath)
+		case dotfile.Permissions.IsChanged():
+			err = os.Chmod(installPath, dotfile.Permissions.Old)
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			failed = append(failed, installPath)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to rollback %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// FinalizeInstall writes the updated lockfile after installation. The files
+// installed into each install target are recorded along with the path of the
+// target, and the state of each installed file is recorded so that later
+// local modifications may be detected and merged.
 func FinalizeInstall(installed []*InstalledDotfile, installConfig InstallConfig) error {
 	installedFiles := make([]string, 0, len(installed))
+	installedTargets := map[string]config.InstalledTarget{}
+	installedLinks := []string{}
+	installedState := map[string]config.FileState{}
 
 	for _, dotfile := range installed {
-		if dotfile.Removed {
+		if dotfile.Suppressed {
+			continue
+		}
+
+		// Removed dotfiles skipped to keep local modifications are still
+		// installed, and remain owned by dots.
+		if dotfile.Removed && !IsSkippedConflict(dotfile.PreparedDotfile, installConfig) {
 			continue
 		}
 		if dotfile.InstallError != nil {
 			continue
 		}
 
-		installedFiles = append(installedFiles, dotfile.Path)
+		installPath := installConfig.installPath(dotfile.Dotfile)
+
+		// Dotfiles which could not be prepared, or were skipped to keep local
+		// modifications, were left as they were. The state they were last
+		// installed with is kept.
+		state, ok := installConfig.SourceLockfile.InstalledState[installPath]
+
+		if dotfile.PrepareError == nil && !IsSkippedConflict(dotfile.PreparedDotfile, installConfig) {
+			state, ok, _ = installedBaseState(dotfile.PreparedDotfile, installPath, state, installConfig)
+		}
+
+		if ok {
+			installedState[installPath] = state
+		}
+
+		if dotfile.ManagedLink {
+			installedLinks = append(installedLinks, dotfile.Path)
+			continue
+		}
+
+		if dotfile.InstallTarget == "" {
+			installedFiles = append(installedFiles, dotfile.Path)
+			continue
+		}
+
+		target := installedTargets[dotfile.InstallTarget]
+		target.Path = installConfig.SourceLockfile.TargetPath(*installConfig.SourceConfig, dotfile.InstallTarget)
+		target.Files = append(target.Files, dotfile.Path)
+
+		installedTargets[dotfile.InstallTarget] = target
 	}
 
 	lockfile := installConfig.SourceLockfile
+
+	// Dotfiles which were not part of the install, such as those excluded by
+	// a filter, are kept as they were last installed.
+	installing := map[string]bool{}
+
+	for _, dotfile := range installed {
+		installing[installConfig.installPath(dotfile.Dotfile)] = true
+	}
+
+	keep := func(installPath string) bool {
+		if installing[installPath] {
+			return false
+		}
+
+		if state, ok := lockfile.InstalledState[installPath]; ok {
+			installedState[installPath] = state
+		}
+
+		return true
+	}
+
+	for _, path := range lockfile.InstalledFiles {
+		if keep(installConfig.targetPath("") + separator + path) {
+			installedFiles = append(installedFiles, path)
+		}
+	}
+
+	for name, previous := range lockfile.InstalledTargets {
+		for _, path := range previous.Files {
+			if !keep(installConfig.targetPath(name) + separator + path) {
+				continue
+			}
+
+			target := installedTargets[name]
+			target.Path = previous.Path
+			target.Files = append(target.Files, path)
+
+			installedTargets[name] = target
+		}
+	}
+
+	for _, path := range lockfile.InstalledLinks {
+		if keep(installConfig.OverrideLinkPath + path) {
+			installedLinks = append(installedLinks, path)
+		}
+	}
+
 	lockfile.InstalledFiles = installedFiles
+	lockfile.InstalledTargets = installedTargets
+	lockfile.InstalledLinks = installedLinks
+	lockfile.InstalledState = installedState
 
 	return config.WriteLockfile(lockfile, installConfig.SourceConfig)
 }
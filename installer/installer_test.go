@@ -0,0 +1,369 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+func TestWriteFile(t *testing.T) {
+	root := t.TempDir()
+
+	linkedPath := filepath.Join(root, "linked")
+	installPath := filepath.Join(root, "bashrc")
+
+	os.WriteFile(linkedPath, []byte("linked\n"), 0644)
+	os.Symlink("linked", installPath)
+
+	if err := writeFile(installPath, strings.NewReader("installed\n"), 0600); err != nil {
+		t.Fatalf("Failed to write file: %s", err)
+	}
+
+	info, err := os.Lstat(installPath)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %s", err)
+	}
+
+	if isSymlink(info) {
+		t.Errorf("Expected symlink to be replaced by a file")
+	}
+
+	if info.Mode()&os.ModePerm != 0600 {
+		t.Errorf("Expected mode = %#o; got = %#o", 0600, info.Mode()&os.ModePerm)
+	}
+
+	if data, _ := os.ReadFile(installPath); string(data) != "installed\n" {
+		t.Errorf("Expected content = %q; got = %q", "installed\n", data)
+	}
+
+	if data, _ := os.ReadFile(linkedPath); string(data) != "linked\n" {
+		t.Errorf("Expected linked file to be unchanged; got = %q", data)
+	}
+
+	if entries, _ := os.ReadDir(root); len(entries) != 2 {
+		t.Errorf("Expected no temporary files to remain; got = %d entries", len(entries))
+	}
+}
+
+func TestRollbackInstall(t *testing.T) {
+	root := t.TempDir()
+
+	sourceConfig := &config.SourceConfig{
+		InstallPath:  filepath.Join(root, "home"),
+		LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+	}
+
+	installConfig := InstallConfig{
+		SourceConfig:   sourceConfig,
+		SourceLockfile: &config.SourceLockfile{},
+		Backups:        NewBackupRun(sourceConfig),
+	}
+
+	path := func(name string) string {
+		return filepath.Join(sourceConfig.InstallPath, name)
+	}
+
+	os.MkdirAll(sourceConfig.InstallPath, 0755)
+
+	// Each file is left as it would be after being installed
+	os.WriteFile(path("replaced"), []byte("old\n"), 0644)
+	installConfig.Backups.Save(path("replaced"))
+	os.WriteFile(path("replaced"), []byte("new\n"), 0644)
+
+	os.WriteFile(path("removed"), []byte("old\n"), 0644)
+	installConfig.Backups.Save(path("removed"))
+	os.Remove(path("removed"))
+
+	os.WriteFile(path("added"), []byte("new\n"), 0644)
+	os.WriteFile(path("mode"), []byte("old\n"), 0600)
+	os.WriteFile(path("failed"), []byte("old\n"), 0644)
+
+	installed := InstalledDotfiles{
+		{PreparedDotfile: &PreparedDotfile{
+			Dotfile:        &resolver.Dotfile{Path: "replaced"},
+			ContentsDiffer: true,
+		}},
+		{PreparedDotfile: &PreparedDotfile{
+			Dotfile: &resolver.Dotfile{Path: "removed", Removed: true},
+		}},
+		{PreparedDotfile: &PreparedDotfile{
+			Dotfile: &resolver.Dotfile{Path: "added", Added: true},
+			IsNew:   true,
+		}},
+		{PreparedDotfile: &PreparedDotfile{
+			Dotfile:     &resolver.Dotfile{Path: "mode"},
+			Permissions: FileMode{Old: 0644, New: 0600},
+		}},
+		{
+			PreparedDotfile: &PreparedDotfile{
+				Dotfile:        &resolver.Dotfile{Path: "failed"},
+				ContentsDiffer: true,
+			},
+			InstallError: fmt.Errorf("failed"),
+		},
+	}
+
+	if err := RollbackInstall(installed, installConfig); err != nil {
+		t.Fatalf("Failed to rollback install: %s", err)
+	}
+
+	for _, name := range []string{"replaced", "removed", "failed"} {
+		if data, _ := os.ReadFile(path(name)); string(data) != "old\n" {
+			t.Errorf("Expected %s content = %q; got = %q", name, "old\n", data)
+		}
+	}
+
+	if _, err := os.Lstat(path("added")); !os.IsNotExist(err) {
+		t.Errorf("Expected added file to be removed")
+	}
+
+	if info, _ := os.Stat(path("mode")); info.Mode()&os.ModePerm != 0644 {
+		t.Errorf("Expected mode = %#o; got = %#o", 0644, info.Mode()&os.ModePerm)
+	}
+}
+
+func TestConflictModes(t *testing.T) {
+	testCases := []struct {
+		mode         ConflictMode
+		willInstall  bool
+		savesLocal   bool
+		keepsOldHash bool
+	}{
+		{mode: ConflictSkip, keepsOldHash: true},
+		{mode: ConflictKeep, keepsOldHash: true},
+		{mode: ConflictForce, willInstall: true, savesLocal: true},
+		{mode: ConflictBackup, willInstall: true, savesLocal: true},
+	}
+
+	for _, testCase := range testCases {
+		root := t.TempDir()
+
+		sourceConfig := &config.SourceConfig{
+			SourcePath:   filepath.Join(root, "source"),
+			InstallPath:  filepath.Join(root, "home"),
+			LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+		}
+
+		installPath := filepath.Join(sourceConfig.InstallPath, "bashrc")
+
+		lockfile := &config.SourceLockfile{
+			InstalledFiles: []string{"bashrc"},
+			InstalledState: map[string]config.FileState{installPath: {Hash: "installed"}},
+		}
+
+		installConfig := InstallConfig{
+			SourceConfig:   sourceConfig,
+			SourceLockfile: lockfile,
+			Backups:        NewBackupRun(sourceConfig),
+			Conflicts:      testCase.mode,
+		}
+
+		os.MkdirAll(filepath.Join(sourceConfig.SourcePath, "base"), 0755)
+		os.MkdirAll(sourceConfig.InstallPath, 0755)
+		os.WriteFile(filepath.Join(sourceConfig.SourcePath, "base", "bashrc"), []byte("source\n"), 0644)
+		os.WriteFile(installPath, []byte("local\n"), 0644)
+
+		dotfile := &PreparedDotfile{
+			Dotfile: &resolver.Dotfile{
+				Path:    "bashrc",
+				Sources: []*resolver.SourceFile{{Group: "base", Path: "base/bashrc"}},
+			},
+			ContentsDiffer:  true,
+			LocallyModified: true,
+			Permissions:     FileMode{Old: 0644, New: 0644},
+		}
+
+		if willInstall := WillInstallDotfile(dotfile, installConfig); willInstall != testCase.willInstall {
+			t.Errorf("Mode %q expected WillInstallDotfile = %t", testCase.mode, testCase.willInstall)
+		}
+
+		// Local versions are only overwritten when they can be restored
+		if testCase.mode == ConflictBackup {
+			withoutBackups := installConfig
+			withoutBackups.Backups = nil
+
+			if err := InstallDotfile(dotfile, withoutBackups); err == nil {
+				t.Errorf("Mode %q expected an error without a backup run", testCase.mode)
+			}
+		}
+
+		if err := InstallDotfile(dotfile, installConfig); err != nil {
+			t.Fatalf("Mode %q failed to install: %s", testCase.mode, err)
+		}
+
+		expected := "local\n"
+		if testCase.willInstall {
+			expected = "source\n"
+		}
+
+		if data, _ := os.ReadFile(installPath); string(data) != expected {
+			t.Errorf("Mode %q expected content = %q; got = %q", testCase.mode, expected, data)
+		}
+
+		backupPath := installConfig.Backups.Path + installPath
+		if data, _ := os.ReadFile(backupPath); (string(data) == "local\n") != testCase.savesLocal {
+			t.Errorf("Mode %q expected local version saved = %t", testCase.mode, testCase.savesLocal)
+		}
+
+		installed := []*InstalledDotfile{{PreparedDotfile: dotfile}}
+
+		if err := FinalizeInstall(installed, installConfig); err != nil {
+			t.Fatalf("Mode %q failed to finalize: %s", testCase.mode, err)
+		}
+
+		keptOldHash := lockfile.InstalledState[installPath].Hash == "installed"
+		if keptOldHash != testCase.keepsOldHash {
+			t.Errorf("Mode %q expected previous state kept = %t", testCase.mode, testCase.keepsOldHash)
+		}
+	}
+}
+
+func TestFinalizeFilteredInstall(t *testing.T) {
+	root := t.TempDir()
+
+	sourceConfig := &config.SourceConfig{
+		SourcePath:   filepath.Join(root, "source"),
+		InstallPath:  filepath.Join(root, "home"),
+		LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+	}
+
+	vimrcPath := filepath.Join(sourceConfig.InstallPath, "vimrc")
+
+	lockfile := &config.SourceLockfile{
+		InstalledFiles: []string{"bashrc", "vimrc"},
+		InstalledState: map[string]config.FileState{vimrcPath: {Hash: "vimrc"}},
+	}
+
+	installConfig := InstallConfig{
+		SourceConfig:   sourceConfig,
+		SourceLockfile: lockfile,
+	}
+
+	os.MkdirAll(filepath.Join(sourceConfig.SourcePath, "base"), 0755)
+	os.MkdirAll(sourceConfig.InstallPath, 0755)
+	os.WriteFile(filepath.Join(sourceConfig.SourcePath, "base", "bashrc"), []byte("bashrc\n"), 0644)
+	os.WriteFile(filepath.Join(sourceConfig.InstallPath, "bashrc"), []byte("bashrc\n"), 0644)
+
+	// Only the bashrc is part of the install
+	installed := []*InstalledDotfile{{PreparedDotfile: &PreparedDotfile{
+		Dotfile: &resolver.Dotfile{
+			Path:    "bashrc",
+			Sources: []*resolver.SourceFile{{Group: "base", Path: "base/bashrc"}},
+		},
+	}}}
+
+	if err := FinalizeInstall(installed, installConfig); err != nil {
+		t.Fatalf("Failed to finalize: %s", err)
+	}
+
+	if len(lockfile.InstalledFiles) != 2 {
+		t.Errorf("Expected installed files = %v; got = %v", []string{"bashrc", "vimrc"}, lockfile.InstalledFiles)
+	}
+
+	if state := lockfile.InstalledState[vimrcPath]; state.Hash != "vimrc" {
+		t.Errorf("Expected the state of the dotfile not installed to be kept")
+	}
+}
+
+func TestFinalizeRemovedConflict(t *testing.T) {
+	testCases := []struct {
+		mode  ConflictMode
+		keeps bool
+	}{
+		{mode: ConflictSkip, keeps: true},
+		{mode: ConflictKeep, keeps: true},
+		{mode: ConflictForce},
+	}
+
+	for _, testCase := range testCases {
+		root := t.TempDir()
+
+		sourceConfig := &config.SourceConfig{
+			SourcePath:   filepath.Join(root, "source"),
+			InstallPath:  filepath.Join(root, "home"),
+			LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+		}
+
+		installPath := filepath.Join(sourceConfig.InstallPath, "bashrc")
+
+		lockfile := &config.SourceLockfile{
+			InstalledFiles: []string{"bashrc"},
+			InstalledState: map[string]config.FileState{installPath: {Hash: "installed"}},
+		}
+
+		installConfig := InstallConfig{
+			SourceConfig:   sourceConfig,
+			SourceLockfile: lockfile,
+			Conflicts:      testCase.mode,
+		}
+
+		// The removed dotfile has been modified since it was last installed
+		installed := []*InstalledDotfile{{PreparedDotfile: &PreparedDotfile{
+			Dotfile:         &resolver.Dotfile{Path: "bashrc", Removed: true},
+			LocallyModified: true,
+		}}}
+
+		if err := FinalizeInstall(installed, installConfig); err != nil {
+			t.Fatalf("Mode %q failed to finalize: %s", testCase.mode, err)
+		}
+
+		if kept := len(lockfile.InstalledFiles) == 1; kept != testCase.keeps {
+			t.Errorf("Mode %q expected installed file kept = %t; got = %v", testCase.mode, testCase.keeps, lockfile.InstalledFiles)
+		}
+
+		_, keptState := lockfile.InstalledState[installPath]
+		if keptState != testCase.keeps {
+			t.Errorf("Mode %q expected installed state kept = %t", testCase.mode, testCase.keeps)
+		}
+	}
+}
+
+func TestConcurrentDirectoryCreation(t *testing.T) {
+	root := t.TempDir()
+
+	sourceConfig := &config.SourceConfig{SourcePath: filepath.Join(root, "source")}
+
+	os.MkdirAll(filepath.Join(sourceConfig.SourcePath, "base", "a"), 0755)
+	os.WriteFile(filepath.Join(sourceConfig.SourcePath, "base", "a", "x"), []byte("x\n"), 0644)
+	os.WriteFile(filepath.Join(sourceConfig.SourcePath, "base", "a", "y"), []byte("y\n"), 0644)
+
+	for i := range 500 {
+		installConfig := InstallConfig{
+			SourceConfig:        sourceConfig,
+			SourceLockfile:      &config.SourceLockfile{},
+			OverrideInstallPath: filepath.Join(root, fmt.Sprintf("home-%d", i)),
+		}
+
+		start := make(chan struct{})
+		errs := make(chan error, 2)
+
+		for _, name := range []string{"x", "y"} {
+			dotfile := &PreparedDotfile{
+				Dotfile: &resolver.Dotfile{
+					Path:    "a/" + name,
+					Sources: []*resolver.SourceFile{{Group: "base", Path: "base/a/" + name}},
+				},
+				IsNew:       true,
+				Permissions: FileMode{New: 0644},
+			}
+
+			go func() {
+				<-start
+				errs <- InstallDotfile(dotfile, installConfig)
+			}()
+		}
+
+		close(start)
+
+		for range 2 {
+			if err := <-errs; err != nil {
+				t.Fatalf("Failed to install concurrently: %s", err)
+			}
+		}
+	}
+}
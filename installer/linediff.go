@@ -0,0 +1,118 @@
+package installer
+
+import (
+	"strings"
+)
+
+// splitLines splits the data into lines, keeping the line terminators so that
+// joining the lines reproduces the data exactly.
+func splitLines(d []byte) []string {
+	lines := strings.SplitAfter(string(d), "\n")
+
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// A lineHunk replaces the lines from start up to end of the original lines
+// with new lines. A hunk with an equal start and end inserts lines.
+type lineHunk struct {
+	start int
+	end   int
+	lines []string
+}
+
+// diffLines determines the hunks which transform the lines of a into the
+// lines of b. Lines not part of the longest common subsequence of both are
+// changed.
+func diffLines(a, b []string) []lineHunk {
+	// Lines common to the start and end of both are never changed
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	a = a[prefix : len(a)-suffix]
+	b = b[prefix : len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	hunks := []lineHunk{}
+	var current *lineHunk
+
+	flush := func() {
+		if current != nil {
+			hunks = append(hunks, *current)
+			current = nil
+		}
+	}
+
+	change := func(i int) *lineHunk {
+		if current == nil {
+			current = &lineHunk{start: prefix + i, end: prefix + i, lines: []string{}}
+		}
+
+		return current
+	}
+
+	i, j := 0, 0
+
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			hunk := change(i)
+			hunk.lines = append(hunk.lines, b[j])
+			j++
+		default:
+			hunk := change(i)
+			hunk.end = prefix + i + 1
+			i++
+		}
+	}
+
+	flush()
+
+	return hunks
+}
+
+// applyHunks applies the hunks, which must be ordered and relative to the
+// lines, producing the changed lines.
+func applyHunks(lines []string, hunks []lineHunk) []string {
+	result := []string{}
+	last := 0
+
+	for _, hunk := range hunks {
+		result = append(result, lines[last:hunk.start]...)
+		result = append(result, hunk.lines...)
+		last = hunk.end
+	}
+
+	return append(result, lines[last:]...)
+}
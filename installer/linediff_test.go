@@ -0,0 +1,65 @@
+package installer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		a        string
+		b        string
+		hunks    []lineHunk
+	}{
+		{
+			caseName: "Identical",
+			a:        "a\nb\n",
+			b:        "a\nb\n",
+			hunks:    []lineHunk{},
+		},
+		{
+			caseName: "Changed line",
+			a:        "a\nb\nc\n",
+			b:        "a\nB\nc\n",
+			hunks:    []lineHunk{{start: 1, end: 2, lines: []string{"B\n"}}},
+		},
+		{
+			caseName: "Inserted lines",
+			a:        "a\nc\n",
+			b:        "a\nb1\nb2\nc\n",
+			hunks:    []lineHunk{{start: 1, end: 1, lines: []string{"b1\n", "b2\n"}}},
+		},
+		{
+			caseName: "Removed line",
+			a:        "a\nb\nc\n",
+			b:        "a\nc\n",
+			hunks:    []lineHunk{{start: 1, end: 2, lines: []string{}}},
+		},
+		{
+			caseName: "Multiple hunks",
+			a:        "a\nb\nc\nd\ne\n",
+			b:        "A\nb\nc\nd\nE\nf\n",
+			hunks: []lineHunk{
+				{start: 0, end: 1, lines: []string{"A\n"}},
+				{start: 4, end: 5, lines: []string{"E\n", "f\n"}},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		a := splitLines([]byte(testCase.a))
+		b := splitLines([]byte(testCase.b))
+
+		hunks := diffLines(a, b)
+
+		if !reflect.DeepEqual(hunks, testCase.hunks) {
+			t.Errorf("Test %q expected hunks = %v; got = %v", testCase.caseName, testCase.hunks, hunks)
+		}
+
+		if applied := strings.Join(applyHunks(a, hunks), ""); applied != testCase.b {
+			t.Errorf("Test %q expected applied hunks = %q; got = %q", testCase.caseName, testCase.b, applied)
+		}
+	}
+}
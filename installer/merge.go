@@ -0,0 +1,225 @@
+package installer
+
+import (
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"go.evanpurkhiser.com/dots/config"
+)
+
+// Merge directives may be used as keys in structured sources to control how
+// the source is merged into the lower layers.
+const (
+	// deleteDirective specifies a list of keys which will be removed from the
+	// lower layers.
+	deleteDirective = "$delete"
+
+	// replaceDirective, when set to true, replaces the map from the lower
+	// layers instead of merging into it.
+	replaceDirective = "$replace"
+
+	// appendDirective may be used as the single key of a map to append the list
+	// it specifies to the list from the lower layers. Lists are otherwise
+	// replaced.
+	appendDirective = "$append"
+)
+
+// structuredFormat describes how to parse and encode a structured document.
+// Documents are represented using yaml.MapSlice for maps so that the order of
+// keys is preserved.
+type structuredFormat struct {
+	parse  func([]byte) (interface{}, error)
+	encode func(interface{}) ([]byte, error)
+}
+
+var structuredFormats = map[config.MergeStrategy]structuredFormat{
+	config.MergeJSON: {parseJSON, encodeJSON},
+	config.MergeYAML: {parseYAML, encodeYAML},
+	config.MergeTOML: {parseTOML, encodeTOML},
+	config.MergeINI:  {parseINI, encodeINI},
+}
+
+// mergeLayers parses each layer using the structured format of the strategy
+// and deep merges each layer into the previous layers. The names are used to
+// identify the layer which failed to parse.
+func mergeLayers(strategy config.MergeStrategy, names []string, layers [][]byte) ([]byte, error) {
+	format, ok := structuredFormats[strategy]
+	if !ok {
+		return nil, fmt.Errorf("unknown merge strategy %q", strategy)
+	}
+
+	// A single layer has nothing to merge into
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+
+	var merged interface{}
+
+	for i, layer := range layers {
+		document, err := format.parse(layer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %s", names[i], err)
+		}
+
+		merged = mergeValues(merged, document)
+	}
+
+	return format.encode(merged)
+}
+
+// mergeValues deep merges the overlay value into the base value. Maps are
+// merged key by key, while all other values are replaced by the overlay.
+// Merge directives are interpreted and removed from the result.
+func mergeValues(base, overlay interface{}) interface{} {
+	switch overlay := overlay.(type) {
+	case yaml.MapSlice:
+		if list, ok := appendList(overlay); ok {
+			baseList, _ := base.([]interface{})
+			return append(append([]interface{}{}, baseList...), stripDirectives(list).([]interface{})...)
+		}
+
+		baseMap, ok := base.(yaml.MapSlice)
+		if !ok || isReplace(overlay) {
+			return stripDirectives(overlay)
+		}
+
+		return mergeMaps(baseMap, overlay)
+	default:
+		return stripDirectives(overlay)
+	}
+}
+
+// mergeMaps merges the overlay map into a copy of the base map.
+func mergeMaps(base, overlay yaml.MapSlice) yaml.MapSlice {
+	merged := append(yaml.MapSlice{}, base...)
+
+	for _, key := range deleteKeys(overlay) {
+		merged = removeKey(merged, key)
+	}
+
+	for _, item := range overlay {
+		if isDirective(item.Key) {
+			continue
+		}
+
+		index := indexOfKey(merged, item.Key)
+
+		if index == -1 {
+			merged = append(merged, yaml.MapItem{Key: item.Key, Value: mergeValues(nil, item.Value)})
+			continue
+		}
+
+		merged[index].Value = mergeValues(merged[index].Value, item.Value)
+	}
+
+	return merged
+}
+
+// stripDirectives removes all merge directives from a value.
+func stripDirectives(value interface{}) interface{} {
+	switch value := value.(type) {
+	case yaml.MapSlice:
+		if list, ok := appendList(value); ok {
+			return stripDirectives(list)
+		}
+
+		stripped := yaml.MapSlice{}
+
+		for _, item := range value {
+			if isDirective(item.Key) {
+				continue
+			}
+
+			stripped = append(stripped, yaml.MapItem{Key: item.Key, Value: stripDirectives(item.Value)})
+		}
+
+		return stripped
+	case []interface{}:
+		stripped := make([]interface{}, len(value))
+
+		for i, item := range value {
+			stripped[i] = stripDirectives(item)
+		}
+
+		return stripped
+	default:
+		return value
+	}
+}
+
+func isDirective(key interface{}) bool {
+	return key == deleteDirective || key == replaceDirective || key == appendDirective
+}
+
+// isReplace indicates if the map has the replace directive set.
+func isReplace(m yaml.MapSlice) bool {
+	index := indexOfKey(m, replaceDirective)
+	if index == -1 {
+		return false
+	}
+
+	switch value := m[index].Value.(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+
+	return false
+}
+
+// appendList returns the list of an append directive map.
+func appendList(m yaml.MapSlice) ([]interface{}, bool) {
+	if len(m) != 1 || m[0].Key != appendDirective {
+		return nil, false
+	}
+
+	list, ok := m[0].Value.([]interface{})
+
+	return list, ok
+}
+
+// deleteKeys returns the list of keys specified by the delete directive. The
+// directive may be a list of keys or a comma separated string of keys.
+func deleteKeys(m yaml.MapSlice) []interface{} {
+	index := indexOfKey(m, deleteDirective)
+	if index == -1 {
+		return nil
+	}
+
+	switch value := m[index].Value.(type) {
+	case []interface{}:
+		return value
+	case string:
+		keys := []interface{}{}
+
+		for _, key := range strings.Split(value, ",") {
+			keys = append(keys, strings.TrimSpace(key))
+		}
+
+		return keys
+	}
+
+	return []interface{}{m[index].Value}
+}
+
+func indexOfKey(m yaml.MapSlice, key interface{}) int {
+	for i, item := range m {
+		if item.Key == key {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func removeKey(m yaml.MapSlice, key interface{}) yaml.MapSlice {
+	index := indexOfKey(m, key)
+	if index == -1 {
+		return m
+	}
+
+	return append(m[:index], m[index+1:]...)
+}
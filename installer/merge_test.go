@@ -0,0 +1,135 @@
+package installer
+
+import (
+	"strings"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+)
+
+func TestMergeLayers(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		strategy config.MergeStrategy
+		layers   []string
+		expected string
+	}{
+		{
+			caseName: "JSON deep merge",
+			strategy: config.MergeJSON,
+			layers: []string{
+				`{"font": {"size": 10, "family": "mono"}, "theme": "dark"}`,
+				`{"font": {"size": 12}, "rulers": [80]}`,
+			},
+			expected: "{\n  \"font\": {\n    \"size\": 12,\n    \"family\": \"mono\"\n  },\n  \"theme\": \"dark\",\n  \"rulers\": [\n    80\n  ]\n}\n",
+		},
+		{
+			caseName: "JSON directives",
+			strategy: config.MergeJSON,
+			layers: []string{
+				`{"a": {"x": 1, "y": 2}, "b": [1], "c": [1], "d": true}`,
+				`{"$delete": ["d"], "a": {"$replace": true, "z": 3}, "b": {"$append": [2]}, "c": [2]}`,
+			},
+			expected: "{\n  \"a\": {\n    \"z\": 3\n  },\n  \"b\": [\n    1,\n    2\n  ],\n  \"c\": [\n    2\n  ]\n}\n",
+		},
+		{
+			caseName: "YAML deep merge",
+			strategy: config.MergeYAML,
+			layers: []string{
+				"font:\n  size: 10\n  family: mono\nkeys: [a]\n",
+				"font:\n  size: 12\nkeys:\n  $append: [b]\n",
+			},
+			expected: "font:\n  size: 12\n  family: mono\nkeys:\n- a\n- b\n",
+		},
+		{
+			caseName: "TOML deep merge",
+			strategy: config.MergeTOML,
+			layers: []string{
+				"title = \"base\"\n[font]\nsize = 10\nfamily = \"mono\"\n",
+				"[font]\nsize = 12\n\"$delete\" = [\"family\"]\n",
+			},
+			expected: "title = \"base\"\n\n[font]\nsize = 12\n",
+		},
+		{
+			caseName: "INI merge",
+			strategy: config.MergeINI,
+			layers: []string{
+				"root = 1\n[user]\nname = Me\nemail = me@example.com\n[core]\neditor = vim\n",
+				"; comment\n$delete = core\n[user]\nemail = work@example.com\n",
+			},
+			expected: "root = 1\n\n[user]\nname = Me\nemail = work@example.com\n",
+		},
+		{
+			caseName: "Single layer is not reformatted",
+			strategy: config.MergeJSON,
+			layers:   []string{`{"a":1}`},
+			expected: `{"a":1}`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		names := make([]string, len(testCase.layers))
+		layers := make([][]byte, len(testCase.layers))
+
+		for i, layer := range testCase.layers {
+			names[i] = "layer"
+			layers[i] = []byte(layer)
+		}
+
+		merged, err := mergeLayers(testCase.strategy, names, layers)
+		if err != nil {
+			t.Errorf("Unexpected error: %s, %s", err, testCase.caseName)
+			continue
+		}
+
+		if string(merged) != testCase.expected {
+			t.Errorf("Expected merged = %q; got merged = %q, %s", testCase.expected, merged, testCase.caseName)
+		}
+	}
+}
+
+func TestMergeLayersParseError(t *testing.T) {
+	layers := [][]byte{[]byte(`{"valid": true}`), []byte(`{"invalid": }`)}
+	names := []string{"base/settings.json", "machines/desktop/settings.json"}
+
+	_, err := mergeLayers(config.MergeJSON, names, layers)
+	if err == nil {
+		t.Fatalf("Expected parse error")
+	}
+
+	if !strings.HasPrefix(err.Error(), "failed to parse machines/desktop/settings.json:") {
+		t.Errorf("Expected error to name the source layer; got error = %s", err)
+	}
+}
+
+func TestParseINIErrors(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		document string
+		err      string
+	}{
+		{
+			caseName: "Section named after a key",
+			document: "core = 1\n[core]\neditor = vim\n",
+			err:      `line 2: section "core" conflicts with key`,
+		},
+		{
+			caseName: "Repeated key",
+			document: "[remote]\nfetch = a\nfetch = b\n",
+			err:      `line 3: repeated key "fetch", keys with multiple values cannot be merged`,
+		},
+		{
+			caseName: "Repeated key in a repeated section",
+			document: "[user]\nname = Me\n[user]\nname = You\n",
+			err:      `line 4: repeated key "name", keys with multiple values cannot be merged`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, err := parseINI([]byte(testCase.document))
+
+		if err == nil || err.Error() != testCase.err {
+			t.Errorf("Test %q expected error = %q; got = %v", testCase.caseName, testCase.err, err)
+		}
+	}
+}
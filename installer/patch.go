@@ -0,0 +1,187 @@
+package installer
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// hunk represents a single hunk of a unified diff.
+type hunk struct {
+	oldStart int
+	text     []string
+
+	// old and new are the lines the hunk expects to replace, and the lines
+	// they will be replaced with.
+	old []string
+	new []string
+}
+
+// parsePatch parses the hunks of a unified diff. File headers are ignored, as
+// a patch is always applied to the dotfile it is named after.
+func parsePatch(d []byte) ([]*hunk, error) {
+	hunks := []*hunk{}
+
+	var current *hunk
+
+	// The number of old and new lines remaining in the current hunk
+	oldRemaining, newRemaining := 0, 0
+
+	lineCount := func(count string) int {
+		if count == "" {
+			return 1
+		}
+
+		n, _ := strconv.Atoi(count)
+		return n
+	}
+
+	for i, line := range strings.Split(strings.TrimSuffix(string(d), "\n"), "\n") {
+		if match := hunkHeaderRegex.FindStringSubmatch(line); match != nil {
+			oldStart, _ := strconv.Atoi(match[1])
+
+			current = &hunk{oldStart: oldStart, text: []string{line}}
+			hunks = append(hunks, current)
+
+			oldRemaining, newRemaining = lineCount(match[2]), lineCount(match[4])
+			continue
+		}
+
+		// No newline at end of file markers are ignored
+		if current != nil && strings.HasPrefix(line, "\\") {
+			current.text = append(current.text, line)
+			continue
+		}
+
+		// Lines outside of hunks, such as file headers, are ignored
+		if current == nil || oldRemaining+newRemaining == 0 {
+			continue
+		}
+
+		// Some editors strip trailing whitespace from blank context lines,
+		// treat empty lines as blank context.
+		if line == "" {
+			line = " "
+		}
+
+		switch line[0] {
+		case ' ':
+			current.old = append(current.old, line[1:])
+			current.new = append(current.new, line[1:])
+			oldRemaining--
+			newRemaining--
+		case '-':
+			current.old = append(current.old, line[1:])
+			oldRemaining--
+		case '+':
+			current.new = append(current.new, line[1:])
+			newRemaining--
+		default:
+			return nil, fmt.Errorf("line %d: unexpected line in hunk: %q", i+1, line)
+		}
+
+		current.text = append(current.text, line)
+	}
+
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("no hunks found")
+	}
+
+	if oldRemaining > 0 || newRemaining > 0 {
+		return nil, fmt.Errorf("hunk #%d is truncated", len(hunks))
+	}
+
+	return hunks, nil
+}
+
+// linesMatch reports if the lines match the expected lines at the offset.
+func linesMatch(lines, expected []string, offset int) bool {
+	if offset < 0 || offset+len(expected) > len(lines) {
+		return false
+	}
+
+	for i, line := range expected {
+		if lines[offset+i] != line {
+			return false
+		}
+	}
+
+	return true
+}
+
+// applyPatch applies a unified diff to the data. Hunks that do not apply at
+// the line they specify are searched for nearby, the first hunk which cannot
+// be applied will produce an error containing the rejected hunk. The name is
+// used to identify the patch in errors.
+func applyPatch(name string, d, patch []byte) ([]byte, error) {
+	hunks, err := parsePatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	hasNewline := bytes.HasSuffix(d, []byte("\n"))
+
+	lines := strings.Split(strings.TrimSuffix(string(d), "\n"), "\n")
+	if len(d) == 0 {
+		lines = []string{}
+	}
+
+	// offset tracks how far the applied hunks have shifted the lines, while
+	// minPosition ensures hunks are never applied before a previous hunk.
+	offset := 0
+	minPosition := 0
+
+	for i, hunk := range hunks {
+		// reference is the line the hunk applies at in the original data.
+		// Hunks which only add lines specify the line they follow.
+		reference := hunk.oldStart - 1
+		if len(hunk.old) == 0 {
+			reference = hunk.oldStart
+		}
+
+		expected := reference + offset
+		position := -1
+
+		for distance := 0; distance <= len(lines); distance++ {
+			before, after := expected-distance, expected+distance
+
+			if before >= minPosition && linesMatch(lines, hunk.old, before) {
+				position = before
+				break
+			}
+
+			if after >= minPosition && linesMatch(lines, hunk.old, after) {
+				position = after
+				break
+			}
+		}
+
+		if position == -1 {
+			return nil, fmt.Errorf(
+				"%s: hunk #%d failed to apply:\n%s",
+				name,
+				i+1,
+				strings.Join(hunk.text, "\n"),
+			)
+		}
+
+		patched := append([]string{}, lines[:position]...)
+		patched = append(patched, hunk.new...)
+		patched = append(patched, lines[position+len(hunk.old):]...)
+
+		lines = patched
+		offset = position - reference + len(hunk.new) - len(hunk.old)
+		minPosition = position + len(hunk.new)
+	}
+
+	patched := strings.Join(lines, "\n")
+	if hasNewline || len(d) == 0 {
+		patched += "\n"
+	}
+
+	return []byte(patched), nil
+}
@@ -0,0 +1,79 @@
+package installer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\nfive\nsix\nseven\n"
+
+	testCases := []struct {
+		caseName string
+		base     string
+		patch    string
+		expected string
+	}{
+		{
+			caseName: "Single hunk with headers",
+			base:     base,
+			patch:    "--- a/file\n+++ b/file\n@@ -2,3 +2,3 @@\n two\n-three\n+THREE\n four\n",
+			expected: "one\ntwo\nTHREE\nfour\nfive\nsix\nseven\n",
+		},
+		{
+			caseName: "Multiple hunks",
+			base:     base,
+			patch:    "@@ -1,2 +1,3 @@\n one\n+one and a half\n two\n@@ -6,2 +7,1 @@\n six\n-seven\n",
+			expected: "one\none and a half\ntwo\nthree\nfour\nfive\nsix\n",
+		},
+		{
+			caseName: "Hunk with shifted line numbers",
+			base:     "zero\n" + base,
+			patch:    "@@ -4,1 +4,1 @@\n-four\n+FOUR\n",
+			expected: "zero\none\ntwo\nthree\nFOUR\nfive\nsix\nseven\n",
+		},
+		{
+			caseName: "Creation patch",
+			base:     "",
+			patch:    "--- /dev/null\n+++ b/file\n@@ -0,0 +1,2 @@\n+one\n+two\n",
+			expected: "one\ntwo\n",
+		},
+		{
+			caseName: "Removed line starting with dashes",
+			base:     "-- comment\nvalue\n",
+			patch:    "@@ -1,2 +1,1 @@\n--- comment\n value\n",
+			expected: "value\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := applyPatch("file.patch", []byte(testCase.base), []byte(testCase.patch))
+		if err != nil {
+			t.Errorf("Unexpected error: %s, %s", err, testCase.caseName)
+			continue
+		}
+
+		if string(actual) != testCase.expected {
+			t.Errorf("Expected = %q; got = %q, %s", testCase.expected, actual, testCase.caseName)
+		}
+	}
+}
+
+func TestApplyPatchRejected(t *testing.T) {
+	patch := "@@ -1,2 +1,2 @@\n one\n-missing\n+replaced\n"
+
+	_, err := applyPatch("base/file.patch", []byte("one\ntwo\n"), []byte(patch))
+	if err == nil {
+		t.Fatalf("Expected rejected hunk error")
+	}
+
+	expected := "base/file.patch: hunk #1 failed to apply:\n@@ -1,2 +1,2 @@\n one\n-missing\n+replaced"
+
+	if err.Error() != expected {
+		t.Errorf("Expected error = %q; got error = %q", expected, err)
+	}
+
+	if _, err := applyPatch("base/file.patch", []byte("one\n"), []byte("not a patch\n")); err == nil || !strings.Contains(err.Error(), "no hunks found") {
+		t.Errorf("Expected no hunks error; got error = %v", err)
+	}
+}
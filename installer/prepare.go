@@ -19,6 +19,17 @@ type PreparedInstall struct {
 	InstallScripts []*InstallScript
 }
 
+// HadError indicates if any dotfiles had errors while preparing.
+func (p PreparedInstall) HadError() bool {
+	for _, dotfile := range p.Dotfiles {
+		if dotfile.PrepareError != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
 // A PreparedDotfile represents a dotfile that has been "prepared" for
 // installation by verifying it's contents against the existing dotfile, and
 // checking various other flags that require knowledge of the existing dotfile.
@@ -45,32 +56,123 @@ type PreparedDotfile struct {
 
 	// SourcePermissionsDiffer indicates that a compiled dotfile (one with
 	// multiple sources) does not have consistent permissions across all
-	// sources. In this case the lowest mode will be used.
+	// sources. In this case only the permissions common to all sources will be
+	// used.
 	SourcePermissionsDiffer bool
 
+	// DirectoryPermissions maps parent directories of the dotfile that have
+	// a mode specified by a file rule to the change in their permissions. The
+	// old mode is 0 when the directory does not exist.
+	DirectoryPermissions map[string]FileMode
+
 	// RemovedNull is a warning flag indicating that the removed dotfile does
 	// not exist in the install tree, though the dotfile is marked as removed.
 	RemovedNull bool
 
+	// LinkTarget is the target of the symlink the dotfile will be installed
+	// as. Dotfiles with a single symlink source are installed as symlinks.
+	LinkTarget string
+
+	// LocallyModified indicates that the installed dotfile no longer matches
+	// the state it was last installed with, it has been edited since.
+	LocallyModified bool
+
+	// SourcesChanged indicates that the sources of the dotfile differ from
+	// the sources it was last installed from.
+	SourcesChanged bool
+
+	// Merge is the result of merging modifications made to the installed
+	// dotfile with changes made to its sources. It is only set when both have
+	// changed since the dotfile was last installed.
+	Merge *MergeResult
+
 	// OverwritesExisting is a warning flag that indicates that installing this
 	// dotfile is overwriting a dotfile that was not part of the lockfile.
 	OverwritesExisting bool
 
+	// CompileWarnings is a list of warnings produced while compiling the
+	// dotfile. The dotfile may still be installed.
+	CompileWarnings []string
+
 	// PrepareError keeps track of errors while preparing the dotfile. Should
 	// this contain any errors, the PreparedDotfile is likely incomplete.
 	PrepareError error
 }
 
+// IsSymlink indicates that the dotfile will be installed as a symlink.
+func (p *PreparedDotfile) IsSymlink() bool {
+	return p.LinkTarget != ""
+}
+
 // IsChanged reports if the prepared dotfile has changes from the target
 // dotfile.
 func (p *PreparedDotfile) IsChanged() bool {
-	return p.IsNew || p.Added || p.Removed || p.ContentsDiffer || p.Permissions.IsChanged()
+	return p.IsNew || p.Added || p.Removed || p.ContentsDiffer ||
+		p.Permissions.IsChanged() || p.DirectoryPermissionsChanged()
+}
+
+// IsConflict reports if installing the dotfile would overwrite, or remove,
+// modifications made to the installed dotfile since it was last installed, or
+// modifications which must be merged with changes to its sources.
+func (p *PreparedDotfile) IsConflict() bool {
+	return (p.LocallyModified && p.IsChanged()) || p.Merge != nil
+}
+
+// Status describes the change installing a prepared dotfile would make.
+type Status string
+
+// Available statuses. Only dotfiles with the in sync status are unchanged by
+// an install.
+const (
+	StatusInSync   Status = "in_sync"
+	StatusAdded    Status = "added"
+	StatusModified Status = "modified"
+	StatusRemoved  Status = "removed"
+	StatusMode     Status = "mode"
+	StatusError    Status = "error"
+)
+
+// Status determines the change installing the dotfile would make. A mode
+// change is only reported when the contents are unchanged.
+func (p *PreparedDotfile) Status() Status {
+	switch {
+	case p.PrepareError != nil:
+		return StatusError
+	case p.Suppressed && !p.Removed, p.RemovedNull:
+		return StatusInSync
+	case p.Removed:
+		return StatusRemoved
+	case p.IsNew || p.Added:
+		return StatusAdded
+	case p.ContentsDiffer:
+		return StatusModified
+	case p.Permissions.IsChanged() || p.DirectoryPermissionsChanged():
+		return StatusMode
+	}
+
+	return StatusInSync
+}
+
+// DirectoryPermissionsChanged reports if any existing parent directory with a
+// specified mode has different permissions.
+func (p *PreparedDotfile) DirectoryPermissionsChanged() bool {
+	for _, mode := range p.DirectoryPermissions {
+		if mode.IsChanged() {
+			return true
+		}
+	}
+
+	return false
 }
 
 // FileMode represents the new and old dotfile file mode.
 type FileMode struct {
 	Old os.FileMode
 	New os.FileMode
+
+	// Declared indicates that the new mode was specified by a file rule,
+	// rather than determined from the source files.
+	Declared bool
 }
 
 // IsChanged returns a boolean value indicating if the modes are equal. Will
@@ -79,15 +181,24 @@ func (d FileMode) IsChanged() bool {
 	return d.New != d.Old && d.Old != 0 && d.New != 0
 }
 
+// IsDrifted indicates that the existing mode no longer matches the declared
+// mode.
+func (d FileMode) IsDrifted() bool {
+	return d.Declared && d.IsChanged()
+}
+
 // InstallScript represents a single installation script that is mapped to one
 // or more dotfiles.
 type InstallScript struct {
 	RequiredBy []*PreparedDotfile
 
 	// Path represents the context that the script should execute in. This is not
-	// absolute, but a relative path to the installation path.
+	// absolute, but a relative path to the installation path of the target.
 	Path string
 
+	// Target is the name of the install target the script executes within.
+	Target string
+
 	// FilePath is the absolute path to the installation script
 	FilePath string
 
@@ -99,10 +210,11 @@ type InstallScript struct {
 }
 
 // ShouldInstall indicates weather the installation script should be executed.
-// This will check weather any of the required dotfiles have changed.
-func (i *InstallScript) ShouldInstall() bool {
+// This will check weather any of the required dotfiles will be installed,
+// dotfiles skipped to keep local modifications do not run their scripts.
+func (i *InstallScript) ShouldInstall(config InstallConfig) bool {
 	for _, dotfile := range i.RequiredBy {
-		if dotfile.IsChanged() {
+		if WillInstallDotfile(dotfile, config) {
 			return true
 		}
 	}
@@ -112,22 +224,57 @@ func (i *InstallScript) ShouldInstall() bool {
 
 // PrepareDotfiles iterates all passed dotfiles and creates an associated
 // PreparedDotfile, returning a PreparedInstall object.
-func PrepareDotfiles(dotfiles resolver.Dotfiles, config config.SourceConfig) PreparedInstall {
+func PrepareDotfiles(dotfiles resolver.Dotfiles, config config.SourceConfig, lockfile config.SourceLockfile) PreparedInstall {
 	preparedDotfiles := make([]*PreparedDotfile, len(dotfiles))
 
+	symlinks := &symlinkResolver{
+		config:      config,
+		lockfile:    lockfile,
+		groups:      lockfile.ResolveGroups(config),
+		sourcePaths: map[string]string{},
+	}
+
+	// installing tracks the dotfiles of the install path which will be
+	// installed, and may be the target of a managed link.
+	installing := map[string]bool{}
+
+	for _, dotfile := range dotfiles {
+		for _, source := range dotfile.ActiveSources() {
+			symlinks.sourcePaths[source.Path] = symlinks.installPath(dotfile.InstallTarget, dotfile.Path)
+		}
+
+		if dotfile.InstallTarget == "" && !dotfile.Removed && !dotfile.Suppressed {
+			installing[dotfile.Path] = true
+		}
+	}
+
 	waitGroup := sync.WaitGroup{}
 	waitGroup.Add(len(dotfiles))
 
 	prepare := func(index int, dotfile *resolver.Dotfile) {
 		defer waitGroup.Done()
 
-		installPath := config.InstallPath + separator + dotfile.Path
+		installRoot := lockfile.TargetPath(config, dotfile.InstallTarget)
+		installPath := installRoot + separator + dotfile.Path
+
+		if dotfile.ManagedLink {
+			installPath = dotfile.Path
+		}
 
 		prepared := PreparedDotfile{
 			Dotfile: dotfile,
 		}
 		preparedDotfiles[index] = &prepared
 
+		// Once compared, local modifications may need to be merged
+		defer prepareMerge(&prepared, installPath, config, lockfile)
+
+		// Suppressed dotfiles which were never installed have nothing to
+		// prepare, they will not be installed.
+		if dotfile.Suppressed && !dotfile.Removed {
+			return
+		}
+
 		targetInfo, targetStatErr := os.Lstat(installPath)
 
 		exists := !os.IsNotExist(targetStatErr)
@@ -148,9 +295,17 @@ func PrepareDotfiles(dotfiles resolver.Dotfiles, config config.SourceConfig) Pre
 			prepared.RemovedNull = true
 		}
 
-		sourceInfo := make([]os.FileInfo, len(dotfile.Sources))
+		// Managed links are only removed while they are still a symlink, a
+		// file which has since replaced the link is left in place.
+		if dotfile.ManagedLink && dotfile.Removed && exists && !isSymlink(targetInfo) {
+			prepared.PrepareError = fmt.Errorf("refusing to remove link, it has been replaced by a file")
+			return
+		}
+
+		sources := dotfile.ActiveSources()
+		sourceInfo := make([]os.FileInfo, len(sources))
 
-		for i, source := range dotfile.Sources {
+		for i, source := range sources {
 			path := config.SourcePath + separator + source.Path
 
 			info, err := os.Lstat(path)
@@ -161,45 +316,141 @@ func PrepareDotfiles(dotfiles resolver.Dotfiles, config config.SourceConfig) Pre
 			sourceInfo[i] = info
 		}
 
-		sourcePermissions, tookLowest := flattenPermissions(sourceInfo)
+		if state, ok := lockfile.InstalledState[installPath]; ok {
+			if err := detectModifications(&prepared, state, installPath, config); err != nil {
+				prepared.PrepareError = err
+				return
+			}
+		}
+
+		// Managed links are installed as a symlink to the installed dotfile.
+		// Dotfiles with a single symlink source are installed as a symlink.
+		// Linked dotfiles which do not need to be compiled are installed as a
+		// symlink to their source. The existing dotfile must be a symlink with
+		// the same target.
+		linkTarget := ""
+
+		switch {
+		case dotfile.ManagedLink && !dotfile.Removed:
+			linkTarget = installRoot + separator + dotfile.LinkedDotfile
+
+			if _, err := os.Stat(linkTarget); !installing[dotfile.LinkedDotfile] && err != nil {
+				prepared.PrepareError = fmt.Errorf("linked dotfile %s is not installed", dotfile.LinkedDotfile)
+				return
+			}
+		case len(sourceInfo) == 1 && isSymlink(sourceInfo[0]):
+			target, err := symlinks.linkTarget(sources[0].Path, installPath)
+			if err != nil {
+				prepared.PrepareError = err
+				return
+			}
+
+			linkTarget = target
+		case isLinked(dotfile) && len(sourceInfo) == 1 &&
+			sourceInfo[0].Mode().IsRegular() && !shouldCompile(dotfile, config):
+			linkTarget = config.SourcePath + separator + sources[0].Path
+		}
+
+		if linkTarget != "" {
+			prepared.LinkTarget = linkTarget
+
+			if !exists {
+				return
+			}
+
+			existingTarget, err := os.Readlink(installPath)
+			prepared.ContentsDiffer = err != nil || existingTarget != linkTarget
+
+			return
+		}
+
+		sourcePermissions, permissionsDiffer := flattenPermissions(sourceInfo)
+
+		// Permissions specified by a file rule take precedence over the
+		// permissions of the sources.
+		if dotfile.Mode != 0 {
+			sourcePermissions, permissionsDiffer = dotfile.Mode, false
+		}
 
 		targetMode := os.FileMode(0)
-		if exists {
+		if exists && !isSymlink(targetInfo) {
 			targetMode = targetInfo.Mode()
 		}
 
 		prepared.Permissions = FileMode{
-			Old: targetMode & os.ModePerm,
-			New: sourcePermissions,
+			Old:      targetMode & os.ModePerm,
+			New:      sourcePermissions,
+			Declared: dotfile.Mode != 0,
 		}
 
-		prepared.SourcePermissionsDiffer = tookLowest
+		prepared.SourcePermissionsDiffer = permissionsDiffer
+
+		for dir, mode := range dotfile.DirectoryModes {
+			if prepared.DirectoryPermissions == nil {
+				prepared.DirectoryPermissions = map[string]FileMode{}
+			}
+
+			dirMode := FileMode{New: mode, Declared: true}
+
+			if info, err := os.Stat(installRoot + separator + dir); err == nil {
+				dirMode.Old = info.Mode() & os.ModePerm
+			}
+
+			prepared.DirectoryPermissions[dir] = dirMode
+		}
 		prepared.SourcesAreIrregular = !isAllRegular(sourceInfo)
 
 		if prepared.SourcesAreIrregular {
 			prepared.PrepareError = fmt.Errorf("source files are not all regular files")
+			return
 		}
 
-		// Nothing needs to be verified if the dotfile is being added or removed.
-		if !exists || dotfile.Removed {
+		// Nothing needs to be verified if the dotfile is being removed.
+		if dotfile.Removed {
 			return
 		}
 
+		compile := shouldCompile(dotfile, config)
+
 		// If the dotfile does not require compilation we can directly compare
 		// the size of the (single) source file with the current target source.
 		// Otherwise we will have to compile to compare.
-		if !shouldCompile(dotfile, config) && targetInfo.Size() != sourceInfo[0].Size() {
+		if !compile && exists && targetInfo.Size() != sourceInfo[0].Size() {
 			prepared.ContentsDiffer = true
 			return
 		}
 
-		source, err := OpenDotfile(dotfile, config)
+		// Nothing needs to be compared if the dotfile is being added. Dotfiles
+		// which must be compiled are still compiled to surface errors before
+		// installation.
+		if !exists && !compile {
+			return
+		}
+
+		source, err := openDotfile(dotfile, config, lockfile)
 		if err != nil {
 			prepared.PrepareError = err
 			return
 		}
 		defer source.Close()
 
+		if err := source.ensureCompiled(); err != nil {
+			prepared.PrepareError = err
+			return
+		}
+
+		prepared.CompileWarnings = source.warnings
+
+		if !exists {
+			return
+		}
+
+		// An existing symlink will be replaced by the dotfile
+		if isSymlink(targetInfo) {
+			prepared.ContentsDiffer = true
+			return
+		}
+
 		target, err := os.Open(installPath)
 		if err != nil {
 			prepared.PrepareError = err
@@ -242,6 +493,7 @@ func PrepareDotfiles(dotfiles resolver.Dotfiles, config config.SourceConfig) Pre
 		script := InstallScript{
 			RequiredBy: dotfiles,
 			Path:       filepath.Dir(dotfiles[0].Path),
+			Target:     dotfiles[0].InstallTarget,
 			FilePath:   config.SourcePath + separator + path,
 		}
 		installScripts = append(installScripts, &script)
@@ -0,0 +1,79 @@
+package installer
+
+import (
+	"fmt"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+func TestPreparedDotfileStatus(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		dotfile  PreparedDotfile
+		status   Status
+	}{
+		{
+			caseName: "Unchanged",
+			dotfile:  PreparedDotfile{Dotfile: &resolver.Dotfile{}},
+			status:   StatusInSync,
+		},
+		{
+			caseName: "New",
+			dotfile:  PreparedDotfile{Dotfile: &resolver.Dotfile{Added: true}, IsNew: true},
+			status:   StatusAdded,
+		},
+		{
+			caseName: "Contents differ",
+			dotfile:  PreparedDotfile{Dotfile: &resolver.Dotfile{}, ContentsDiffer: true},
+			status:   StatusModified,
+		},
+		{
+			caseName: "Contents and mode differ",
+			dotfile: PreparedDotfile{
+				Dotfile:        &resolver.Dotfile{},
+				ContentsDiffer: true,
+				Permissions:    FileMode{Old: 0644, New: 0600},
+			},
+			status: StatusModified,
+		},
+		{
+			caseName: "Only mode differs",
+			dotfile: PreparedDotfile{
+				Dotfile:     &resolver.Dotfile{},
+				Permissions: FileMode{Old: 0644, New: 0600},
+			},
+			status: StatusMode,
+		},
+		{
+			caseName: "Removed",
+			dotfile:  PreparedDotfile{Dotfile: &resolver.Dotfile{Removed: true}},
+			status:   StatusRemoved,
+		},
+		{
+			caseName: "Removed and does not exist",
+			dotfile:  PreparedDotfile{Dotfile: &resolver.Dotfile{Removed: true}, RemovedNull: true},
+			status:   StatusInSync,
+		},
+		{
+			caseName: "Suppressed",
+			dotfile:  PreparedDotfile{Dotfile: &resolver.Dotfile{Suppressed: true}},
+			status:   StatusInSync,
+		},
+		{
+			caseName: "Prepare error",
+			dotfile: PreparedDotfile{
+				Dotfile:        &resolver.Dotfile{},
+				ContentsDiffer: true,
+				PrepareError:   fmt.Errorf("failed"),
+			},
+			status: StatusError,
+		},
+	}
+
+	for _, testCase := range testCases {
+		if status := testCase.dotfile.Status(); status != testCase.status {
+			t.Errorf("Test %q expected status = %q; got = %q", testCase.caseName, testCase.status, status)
+		}
+	}
+}
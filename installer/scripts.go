@@ -32,7 +32,7 @@ func (i *ExecutedScripts) HadError() bool {
 
 // RunInstallScript executes a single InstallScript.
 func RunInstallScript(script *InstallScript, config InstallConfig) error {
-	if !script.ShouldInstall() && !config.ForceReinstall {
+	if !script.ShouldInstall(config) {
 		return nil
 	}
 
@@ -40,16 +40,17 @@ func RunInstallScript(script *InstallScript, config InstallConfig) error {
 		return nil
 	}
 
-	command := exec.Command(script.FilePath)
-
 	// Execute the script in the installed path context
-	if config.OverrideInstallPath != "" {
-		command.Dir = config.OverrideInstallPath
-	} else {
-		command.Dir = config.SourceConfig.InstallPath
-	}
+	dir := config.targetPath(script.Target) + separator + script.Path
+
+	return scriptCommand(script.FilePath, dir, config).Run()
+}
 
-	command.Dir = command.Dir + separator + script.Path
+// scriptCommand creates the command executing the install script within the
+// directory.
+func scriptCommand(scriptPath, dir string, config InstallConfig) *exec.Cmd {
+	command := exec.Command(scriptPath)
+	command.Dir = dir
 
 	// Setup the environment
 	command.Env = append(
@@ -61,7 +62,7 @@ func RunInstallScript(script *InstallScript, config InstallConfig) error {
 	command.Stdout = os.Stdout
 	command.Stderr = os.Stderr
 
-	return command.Run()
+	return command
 }
 
 // RunInstallScripts executes the installation scripts of a PreparedInstall for
@@ -0,0 +1,65 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+func TestRunInstallScriptConflicts(t *testing.T) {
+	testCases := []struct {
+		mode ConflictMode
+		runs bool
+	}{
+		{mode: ConflictSkip},
+		{mode: ConflictKeep},
+		{mode: ConflictForce, runs: true},
+	}
+
+	for _, testCase := range testCases {
+		root := t.TempDir()
+
+		sourceConfig := &config.SourceConfig{
+			SourcePath:  filepath.Join(root, "source"),
+			InstallPath: filepath.Join(root, "home"),
+		}
+
+		os.MkdirAll(sourceConfig.SourcePath, 0755)
+		os.MkdirAll(sourceConfig.InstallPath, 0755)
+
+		scriptPath := filepath.Join(sourceConfig.SourcePath, "bashrc.install")
+		os.WriteFile(scriptPath, []byte("#!/bin/sh\ntouch ran\n"), 0755)
+
+		// The dotfile has been modified since it was last installed
+		dotfile := &PreparedDotfile{
+			Dotfile:         &resolver.Dotfile{Path: "bashrc"},
+			ContentsDiffer:  true,
+			LocallyModified: true,
+		}
+
+		script := &InstallScript{
+			RequiredBy: []*PreparedDotfile{dotfile},
+			Path:       ".",
+			FilePath:   scriptPath,
+			Executable: true,
+		}
+
+		installConfig := InstallConfig{
+			SourceConfig:   sourceConfig,
+			SourceLockfile: &config.SourceLockfile{},
+			Conflicts:      testCase.mode,
+		}
+
+		if err := RunInstallScript(script, installConfig); err != nil {
+			t.Fatalf("Mode %q failed to run script: %s", testCase.mode, err)
+		}
+
+		_, err := os.Stat(filepath.Join(sourceConfig.InstallPath, "ran"))
+		if ran := err == nil; ran != testCase.runs {
+			t.Errorf("Mode %q expected script run = %t", testCase.mode, testCase.runs)
+		}
+	}
+}
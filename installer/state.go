@@ -0,0 +1,105 @@
+package installer
+
+import (
+	"os"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+// readFileState describes the installed file at the path. False is returned
+// when nothing is installed at the path.
+func readFileState(path string) (config.FileState, bool, error) {
+	file, _, err := readGenerationFile(path)
+	if err != nil || file == nil {
+		return config.FileState{}, false, err
+	}
+
+	state := config.FileState{
+		Hash:       file.Hash,
+		Mode:       file.Mode,
+		LinkTarget: file.LinkTarget,
+	}
+
+	return state, true, nil
+}
+
+// sourceHashes hashes the contents of each active source of the dotfile.
+// Symlink sources are hashed by their target.
+func sourceHashes(dotfile *resolver.Dotfile, conf config.SourceConfig) (map[string]string, error) {
+	hashes := map[string]string{}
+
+	for _, source := range dotfile.ActiveSources() {
+		path := conf.SourcePath + separator + source.Path
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var data []byte
+
+		if isSymlink(info) {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return nil, err
+			}
+
+			data = []byte(target)
+		} else if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+
+		hashes[source.Path] = hashContents(data)
+	}
+
+	return hashes, nil
+}
+
+// sameHashes reports if both sets of hashes are the same.
+func sameHashes(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for path, hash := range a {
+		if other, ok := b[path]; !ok || other != hash {
+			return false
+		}
+	}
+
+	return true
+}
+
+// detectModifications compares the installed file, and the sources of the
+// dotfile, with the state they were last installed with.
+func detectModifications(prepared *PreparedDotfile, state config.FileState, installPath string, conf config.SourceConfig) error {
+	current, exists, err := readFileState(installPath)
+	if err != nil {
+		return err
+	}
+
+	prepared.LocallyModified = exists && !state.Matches(current)
+
+	hashes, err := sourceHashes(prepared.Dotfile, conf)
+	if err != nil {
+		return err
+	}
+
+	prepared.SourcesChanged = !sameHashes(hashes, state.Sources)
+
+	return nil
+}
+
+// installedFileState determines the state the dotfile was installed with.
+// False is returned when nothing is installed at the path.
+func installedFileState(dotfile *resolver.Dotfile, installPath string, conf config.SourceConfig) (config.FileState, bool, error) {
+	state, exists, err := readFileState(installPath)
+	if err != nil || !exists {
+		return state, exists, err
+	}
+
+	state.Sources, err = sourceHashes(dotfile, conf)
+
+	return state, err == nil, err
+}
@@ -0,0 +1,87 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+func TestDetectModifications(t *testing.T) {
+	root := t.TempDir()
+
+	conf := config.SourceConfig{SourcePath: filepath.Join(root, "source")}
+
+	sourcePath := filepath.Join(conf.SourcePath, "base", "bashrc")
+	installPath := filepath.Join(root, "bashrc")
+
+	os.MkdirAll(filepath.Dir(sourcePath), 0755)
+	os.WriteFile(sourcePath, []byte("source\n"), 0644)
+	os.WriteFile(installPath, []byte("source\n"), 0644)
+
+	dotfile := &resolver.Dotfile{
+		Path:    "bashrc",
+		Sources: []*resolver.SourceFile{{Group: "base", Path: "base/bashrc"}},
+	}
+
+	state, ok, err := installedFileState(dotfile, installPath, conf)
+	if err != nil || !ok {
+		t.Fatalf("Failed to determine installed state: %v", err)
+	}
+
+	testCases := []struct {
+		caseName        string
+		modify          func()
+		locallyModified bool
+		sourcesChanged  bool
+	}{
+		{
+			caseName: "Unchanged",
+			modify:   func() {},
+		},
+		{
+			caseName:        "Installed file edited",
+			modify:          func() { os.WriteFile(installPath, []byte("edited\n"), 0644) },
+			locallyModified: true,
+		},
+		{
+			caseName:        "Installed file mode changed",
+			modify:          func() { os.Chmod(installPath, 0600) },
+			locallyModified: true,
+		},
+		{
+			caseName:       "Source changed",
+			modify:         func() { os.WriteFile(sourcePath, []byte("changed\n"), 0644) },
+			sourcesChanged: true,
+		},
+		{
+			caseName: "Installed file removed",
+			modify:   func() { os.Remove(installPath) },
+		},
+	}
+
+	for _, testCase := range testCases {
+		os.WriteFile(sourcePath, []byte("source\n"), 0644)
+		os.WriteFile(installPath, []byte("source\n"), 0644)
+		os.Chmod(installPath, 0644)
+
+		testCase.modify()
+
+		prepared := &PreparedDotfile{Dotfile: dotfile}
+
+		if err := detectModifications(prepared, state, installPath, conf); err != nil {
+			t.Errorf("Test %q failed: %s", testCase.caseName, err)
+			continue
+		}
+
+		if prepared.LocallyModified != testCase.locallyModified {
+			t.Errorf("Test %q expected LocallyModified = %t", testCase.caseName, testCase.locallyModified)
+		}
+
+		if prepared.SourcesChanged != testCase.sourcesChanged {
+			t.Errorf("Test %q expected SourcesChanged = %t", testCase.caseName, testCase.sourcesChanged)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package installer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+// isSymlink indicates if the file info describes a symlink.
+func isSymlink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink != 0
+}
+
+// isLinked indicates if the dotfile should be installed as a symlink to its
+// source when it does not need to be compiled. Dotfiles declaring a mode are
+// copied, as the mode of a symlink is that of the source it points at.
+func isLinked(dotfile *resolver.Dotfile) bool {
+	return dotfile.InstallMode == config.InstallLink && dotfile.Mode == 0
+}
+
+// symlinkResolver determines the target that symlink sources are installed
+// with.
+type symlinkResolver struct {
+	config   config.SourceConfig
+	lockfile config.SourceLockfile
+	groups   []string
+
+	// sourcePaths maps the source paths of all dotfiles being prepared to the
+	// absolute path the dotfile is installed at.
+	sourcePaths map[string]string
+}
+
+// installPath returns the absolute path the dotfile is installed at.
+func (r *symlinkResolver) installPath(target, dotfilePath string) string {
+	return r.lockfile.TargetPath(r.config, target) + separator + dotfilePath
+}
+
+// linkTarget reads the target of the symlink source and determines the target
+// of the installed symlink.
+func (r *symlinkResolver) linkTarget(sourcePath, installPath string) (string, error) {
+	link, err := os.Readlink(r.config.SourcePath + separator + sourcePath)
+	if err != nil {
+		return "", err
+	}
+
+	if r.config.Symlinks == config.SymlinksVerbatim {
+		return link, nil
+	}
+
+	return r.rewriteLinkTarget(link, sourcePath, installPath), nil
+}
+
+// rewriteLinkTarget rewrites the target of a symlink source so that it remains
+// correct once installed. Absolute targets are unchanged. Relative targets
+// pointing at a dotfile source, or into an active group, are rewritten to be
+// relative to the installed dotfile, which may be in a different install
+// target. All other relative targets are made absolute into the source tree.
+func (r *symlinkResolver) rewriteLinkTarget(link, sourcePath, installPath string) string {
+	if filepath.IsAbs(link) {
+		return link
+	}
+
+	linked := filepath.Join(filepath.Dir(sourcePath), link)
+
+	installed, ok := r.sourcePaths[linked]
+	if !ok {
+		var groupPath string
+
+		if groupPath, ok = r.groupPath(linked); ok {
+			installed = r.installPath(r.config.TargetDirectory(groupPath))
+		}
+	}
+
+	if !ok {
+		return filepath.Join(r.config.SourcePath, linked)
+	}
+
+	relative, err := filepath.Rel(filepath.Dir(installPath), installed)
+	if err != nil {
+		return installed
+	}
+
+	return relative
+}
+
+// groupPath returns the path within the install tree of a path within the
+// source tree, if the path is within an active group. The most specific group
+// is used when groups are nested.
+func (r *symlinkResolver) groupPath(path string) (string, bool) {
+	group := ""
+
+	for _, candidate := range r.groups {
+		if strings.HasPrefix(path, candidate+separator) && len(candidate) > len(group) {
+			group = candidate
+		}
+	}
+
+	if group == "" {
+		return "", false
+	}
+
+	return strings.TrimPrefix(path, group+separator), true
+}
+
+// installSymlink installs a symlink at the install path, atomically replacing
+// any existing file or symlink.
+func installSymlink(installPath, target string) error {
+	info, err := os.Lstat(installPath)
+
+	if err == nil && info.IsDir() {
+		return fmt.Errorf("refusing to replace directory with symlink")
+	}
+
+	temp, err := tempPath(installPath)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Symlink(target, temp); err != nil {
+		return err
+	}
+
+	if err := os.Rename(temp, installPath); err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	return nil
+}
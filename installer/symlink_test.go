@@ -0,0 +1,149 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+func TestRewriteLinkTarget(t *testing.T) {
+	resolver := &symlinkResolver{
+		config: config.SourceConfig{
+			SourcePath:  "/dots",
+			InstallPath: "/home/.config",
+			Targets: map[string]config.InstallTarget{
+				"home": {Path: "/home", Directory: "home"},
+			},
+		},
+		groups: []string{"base", "machines/desktop"},
+		sourcePaths: map[string]string{
+			"base/vim/shared.lua":       "/home/.config/vim/shared.lua",
+			"base/bash/profile.tmpl":    "/home/.config/bash/profile",
+			"machines/desktop/gitalias": "/home/.config/git/alias",
+			"base/home/.bashrc":         "/home/.bashrc",
+		},
+	}
+
+	testCases := []struct {
+		caseName    string
+		link        string
+		sourcePath  string
+		installPath string
+		expected    string
+	}{
+		{
+			caseName:    "Absolute target",
+			link:        "/usr/share/vim/vimrc",
+			sourcePath:  "base/vimrc",
+			installPath: "/home/.config/vimrc",
+			expected:    "/usr/share/vim/vimrc",
+		},
+		{
+			caseName:    "Target within the same group",
+			link:        "../vim/shared.lua",
+			sourcePath:  "base/nvim/init.lua",
+			installPath: "/home/.config/nvim/init.lua",
+			expected:    "../vim/shared.lua",
+		},
+		{
+			caseName:    "Target with a different dotfile path",
+			link:        "../../machines/desktop/gitalias",
+			sourcePath:  "base/git/alias-link",
+			installPath: "/home/.config/git/alias-link",
+			expected:    "alias",
+		},
+		{
+			caseName:    "Target installed at a different location",
+			link:        "bash/profile.tmpl",
+			sourcePath:  "base/profile",
+			installPath: "/home/.config/profile",
+			expected:    "bash/profile",
+		},
+		{
+			caseName:    "Target directory within a group",
+			link:        "../../../base/vim/plugins",
+			sourcePath:  "machines/desktop/nvim/plugins",
+			installPath: "/home/.config/nvim/plugins",
+			expected:    "../vim/plugins",
+		},
+		{
+			caseName:    "Target in another install target",
+			link:        "../bash/profile.tmpl",
+			sourcePath:  "base/home/.profile",
+			installPath: "/home/.profile",
+			expected:    ".config/bash/profile",
+		},
+		{
+			caseName:    "Target directory within another install target",
+			link:        "../home/.local/share",
+			sourcePath:  "base/nvim/share",
+			installPath: "/home/.config/nvim/share",
+			expected:    "../../.local/share",
+		},
+		{
+			caseName:    "Target outside of any group",
+			link:        "../../vendor/plugin",
+			sourcePath:  "base/nvim/plugin",
+			installPath: "/home/.config/nvim/plugin",
+			expected:    "/dots/vendor/plugin",
+		},
+		{
+			caseName:    "Target outside of the source tree",
+			link:        "../../../shared/lua",
+			sourcePath:  "base/nvim/lua",
+			installPath: "/home/.config/nvim/lua",
+			expected:    "/shared/lua",
+		},
+	}
+
+	for _, testCase := range testCases {
+		actual := resolver.rewriteLinkTarget(testCase.link, testCase.sourcePath, testCase.installPath)
+
+		if actual != testCase.expected {
+			t.Errorf("Expected = %q; got = %q, %s", testCase.expected, actual, testCase.caseName)
+		}
+	}
+}
+
+func TestLinkInstallMode(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		mode     os.FileMode
+		linked   bool
+	}{
+		{caseName: "Linked to the source", linked: true},
+		{caseName: "Copied with a declared mode", mode: 0600},
+	}
+
+	for _, testCase := range testCases {
+		root := t.TempDir()
+
+		sourceConfig := config.SourceConfig{
+			SourcePath:  filepath.Join(root, "source"),
+			InstallPath: filepath.Join(root, "home"),
+		}
+
+		os.MkdirAll(filepath.Join(sourceConfig.SourcePath, "base"), 0755)
+		os.WriteFile(filepath.Join(sourceConfig.SourcePath, "base", "bashrc"), []byte("bashrc\n"), 0644)
+
+		dotfiles := resolver.Dotfiles{{
+			Path:        "bashrc",
+			Mode:        testCase.mode,
+			InstallMode: config.InstallLink,
+			Sources:     []*resolver.SourceFile{{Group: "base", Path: "base/bashrc"}},
+		}}
+
+		dotfile := PrepareDotfiles(dotfiles, sourceConfig, config.SourceLockfile{}).Dotfiles[0]
+
+		if linked := dotfile.IsSymlink(); linked != testCase.linked {
+			t.Errorf("Test %q expected linked = %t", testCase.caseName, testCase.linked)
+		}
+
+		if !testCase.linked && dotfile.Permissions.New != testCase.mode {
+			t.Errorf("Test %q expected mode = %#o; got = %#o", testCase.caseName, testCase.mode, dotfile.Permissions.New)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package installer
+
+import (
+	"bytes"
+	"text/template"
+
+	"go.evanpurkhiser.com/dots/config"
+)
+
+// TemplateData is the data model that templated dotfile sources are rendered
+// against.
+type TemplateData struct {
+	config.Facts
+
+	// Vars holds the user defined variables from the source config, merged
+	// for the active groups and profile.
+	Vars config.Variables
+}
+
+// InGroup reports if the named group is one of the active groups. This may be
+// used within templates, e.g:
+//
+//	{{ if .InGroup "machines/desktop" }}...{{ end }}
+func (d TemplateData) InGroup(name string) bool {
+	for _, group := range d.Groups {
+		if group == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewTemplateData constructs the TemplateData for the given configuration and
+// lockfile.
+func NewTemplateData(config config.SourceConfig, lockfile config.SourceLockfile) TemplateData {
+	return TemplateData{
+		Facts: lockfile.ResolveFacts(config),
+		Vars:  lockfile.ResolveVariables(config).Values(),
+	}
+}
+
+var templateFuncs = template.FuncMap{
+	"env": func(key string) string { return envGetter(key) },
+}
+
+// renderTemplate renders a byte slice as a text/template against the template
+// data. The name should be the path of the source file, as it will be included
+// in any parse or execution errors along with the line number.
+func renderTemplate(name string, d []byte, data TemplateData) ([]byte, error) {
+	tmpl := template.New(name).Funcs(templateFuncs).Option("missingkey=error")
+
+	if _, err := tmpl.Parse(string(d)); err != nil {
+		return nil, err
+	}
+
+	buffer := bytes.NewBuffer(nil)
+
+	if err := tmpl.Execute(buffer, data); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
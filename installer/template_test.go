@@ -0,0 +1,67 @@
+package installer
+
+import (
+	"strings"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	data := TemplateData{
+		Facts: config.Facts{
+			Hostname: "desktop",
+			OS:       "linux",
+			Profile:  "home",
+			Groups:   []string{"base", "machines/desktop"},
+		},
+		Vars: config.Variables{
+			"font_size": 12,
+		},
+	}
+
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"Nothing to render", "Nothing to render"},
+		{"host={{ .Hostname }} os={{ .OS }}", "host=desktop os=linux"},
+		{"size={{ .Vars.font_size }}", "size=12"},
+		{"{{ if .InGroup \"machines/desktop\" }}desktop{{ end }}", "desktop"},
+		{"{{ if .InGroup \"machines/server\" }}server{{ end }}", ""},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := renderTemplate("base/test", []byte(testCase.input), data)
+		if err != nil {
+			t.Errorf("Unexpected error rendering %q: %s", testCase.input, err)
+			continue
+		}
+
+		if string(actual) != testCase.expected {
+			t.Errorf("Expected string = %s; got string = %s", testCase.expected, actual)
+		}
+	}
+}
+
+func TestRenderTemplateErrors(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"line one\n{{ .Missing }", "template: base/test:2:"},
+		{"line one\nline two\n{{ .Vars.missing }}", "template: base/test:3:"},
+	}
+
+	for _, testCase := range testCases {
+		_, err := renderTemplate("base/test", []byte(testCase.input), TemplateData{})
+		if err == nil {
+			t.Errorf("Expected error rendering %q", testCase.input)
+			continue
+		}
+
+		if !strings.HasPrefix(err.Error(), testCase.expected) {
+			t.Errorf("Expected error prefix = %s; got error = %s", testCase.expected, err)
+		}
+	}
+}
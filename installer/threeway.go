@@ -0,0 +1,269 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.evanpurkhiser.com/dots/config"
+)
+
+// Conflict markers delimit the lines of the installed dotfile and the lines of
+// the compiled sources which could not be merged.
+const (
+	conflictStart  = "<<<<<<< installed\n"
+	conflictMiddle = "=======\n"
+	conflictEnd    = ">>>>>>> sources\n"
+)
+
+// A MergeResult is the outcome of merging the modifications made to an
+// installed dotfile with the changes made to its sources.
+type MergeResult struct {
+	// Content is the merged dotfile. Lines which could not be merged are
+	// delimited by conflict markers.
+	Content []byte
+
+	// Compiled is the dotfile compiled from the sources, which becomes the
+	// base of later merges once the merge is installed.
+	Compiled []byte
+
+	// Conflicts is the number of regions which could not be merged.
+	Conflicts int
+}
+
+// mergesDotfile indicates that the dotfile will be installed from its merge
+// result rather than from its sources.
+func (c InstallConfig) mergesDotfile(dotfile *PreparedDotfile) bool {
+	if dotfile.Merge == nil || c.Conflicts != ConflictSkip {
+		return false
+	}
+
+	return dotfile.Merge.Conflicts == 0 || c.ConflictMarkers
+}
+
+// prepareMerge merges the modifications made to the installed dotfile with
+// the changes made to its sources, using the dotfile compiled when it was last
+// installed as the base. Without a stored base nothing is merged.
+//
+// Modifications kept by an earlier merge are not changes to install while the
+// dotfile compiles to the same base, whether or not its sources changed.
+func prepareMerge(prepared *PreparedDotfile, installPath string, conf config.SourceConfig, lockfile config.SourceLockfile) {
+	state, ok := lockfile.InstalledState[installPath]
+
+	if !ok || prepared.PrepareError != nil || prepared.Removed || prepared.IsNew ||
+		prepared.IsSymlink() || !prepared.ContentsDiffer {
+		return
+	}
+
+	current, local, err := readGenerationFile(installPath)
+	if err != nil {
+		prepared.PrepareError = err
+		return
+	}
+
+	// Nothing to merge when the installed file is still the compiled base
+	if current == nil || current.LinkTarget != "" || current.Hash == state.BaseHash() {
+		return
+	}
+
+	source, err := openDotfile(prepared.Dotfile, conf, lockfile)
+	if err != nil {
+		prepared.PrepareError = err
+		return
+	}
+	defer source.Close()
+
+	if err := source.ensureCompiled(); err != nil {
+		prepared.PrepareError = err
+		return
+	}
+
+	compiled := append([]byte{}, source.content.Bytes()...)
+
+	// The dotfile compiles to the base, only the local modifications differ
+	if hashContents(compiled) == state.BaseHash() {
+		if state.Base != "" {
+			prepared.ContentsDiffer = false
+		}
+
+		return
+	}
+
+	base, err := os.ReadFile(filepath.Join(objectsPath(&conf), state.BaseHash()))
+	if os.IsNotExist(err) {
+		return
+	}
+
+	if err != nil {
+		prepared.PrepareError = err
+		return
+	}
+
+	if isBinary(base) || isBinary(local) || isBinary(compiled) {
+		return
+	}
+
+	merged, conflicts := mergeLines(splitLines(base), splitLines(local), splitLines(compiled))
+
+	prepared.Merge = &MergeResult{
+		Content:   []byte(strings.Join(merged, "")),
+		Compiled:  compiled,
+		Conflicts: conflicts,
+	}
+}
+
+// mergeLines performs a three-way merge of the local and updated lines, both
+// changed from the base lines. Changes of either side which touch are merged
+// as a single region, which conflicts unless both sides made the same change.
+// The merged lines are returned with the number of conflicting regions.
+func mergeLines(base, local, updated []string) ([]string, int) {
+	localHunks := diffLines(base, local)
+	updatedHunks := diffLines(base, updated)
+
+	merged := []string{}
+	conflicts := 0
+	last := 0
+
+	i, j := 0, 0
+
+	for i < len(localHunks) || j < len(updatedHunks) {
+		start := 0
+
+		if j == len(updatedHunks) || (i < len(localHunks) && localHunks[i].start <= updatedHunks[j].start) {
+			start = localHunks[i].start
+		} else {
+			start = updatedHunks[j].start
+		}
+
+		// Extend the region over every hunk of either side touching it
+		end := start
+		localFirst, updatedFirst := i, j
+
+		for {
+			if i < len(localHunks) && localHunks[i].start <= end {
+				end = max(end, localHunks[i].end)
+				i++
+				continue
+			}
+
+			if j < len(updatedHunks) && updatedHunks[j].start <= end {
+				end = max(end, updatedHunks[j].end)
+				j++
+				continue
+			}
+
+			break
+		}
+
+		localLines := applyHunks(base[start:end], offsetHunks(localHunks[localFirst:i], start))
+		updatedLines := applyHunks(base[start:end], offsetHunks(updatedHunks[updatedFirst:j], start))
+
+		merged = append(merged, base[last:start]...)
+
+		switch {
+		case updatedFirst == j:
+			merged = append(merged, localLines...)
+		case localFirst == i, slices.Equal(localLines, updatedLines):
+			merged = append(merged, updatedLines...)
+		default:
+			merged = append(merged, conflictLines(localLines, updatedLines)...)
+			conflicts++
+		}
+
+		last = end
+	}
+
+	return append(merged, base[last:]...), conflicts
+}
+
+// conflictLines delimits the conflicting lines of both sides with conflict
+// markers. Lines common to the start and end of both sides are not part of
+// the conflict.
+func conflictLines(local, updated []string) []string {
+	prefix := 0
+	for prefix < len(local) && prefix < len(updated) && local[prefix] == updated[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(local)-prefix && suffix < len(updated)-prefix &&
+		local[len(local)-1-suffix] == updated[len(updated)-1-suffix] {
+		suffix++
+	}
+
+	lines := append([]string{}, local[:prefix]...)
+	lines = append(lines, conflictStart)
+	lines = append(lines, terminateLines(local[prefix:len(local)-suffix])...)
+	lines = append(lines, conflictMiddle)
+	lines = append(lines, terminateLines(updated[prefix:len(updated)-suffix])...)
+	lines = append(lines, conflictEnd)
+
+	return append(lines, local[len(local)-suffix:]...)
+}
+
+// offsetHunks returns the hunks relative to the line at the offset.
+func offsetHunks(hunks []lineHunk, offset int) []lineHunk {
+	offsetHunks := make([]lineHunk, len(hunks))
+
+	for i, hunk := range hunks {
+		offsetHunks[i] = lineHunk{start: hunk.start - offset, end: hunk.end - offset, lines: hunk.lines}
+	}
+
+	return offsetHunks
+}
+
+// terminateLines ensures the last line is terminated, such that a conflict
+// marker following the lines begins on its own line.
+func terminateLines(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+
+	terminated := slices.Clone(lines)
+	terminated[len(terminated)-1] += "\n"
+
+	return terminated
+}
+
+// installedBaseState determines the state of the installed dotfile along with
+// the base it was compiled as, storing the contents of the base so that later
+// changes to the sources may be merged with local modifications. False is
+// returned when nothing is installed at the path.
+func installedBaseState(dotfile *PreparedDotfile, installPath string, previous config.FileState, installConfig InstallConfig) (config.FileState, bool, error) {
+	conf := installConfig.SourceConfig
+
+	state, ok, err := installedFileState(dotfile.Dotfile, installPath, *conf)
+	if err != nil || !ok || state.LinkTarget != "" {
+		return state, ok, err
+	}
+
+	switch {
+	case installConfig.mergesDotfile(dotfile):
+		state.Base = hashContents(dotfile.Merge.Compiled)
+
+		if err := storeObject(conf, state.Base, dotfile.Merge.Compiled); err != nil {
+			return state, false, err
+		}
+
+	// Modifications kept by an earlier merge are still relative to its base
+	case previous.Base != "" && !WillInstallDotfile(dotfile, installConfig):
+		state.Base = previous.Base
+
+	default:
+		data, err := os.ReadFile(installPath)
+		if err != nil {
+			return state, false, err
+		}
+
+		if err := storeObject(conf, state.Hash, data); err != nil {
+			return state, false, err
+		}
+	}
+
+	if state.Base == state.Hash {
+		state.Base = ""
+	}
+
+	return state, true, nil
+}
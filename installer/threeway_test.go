@@ -0,0 +1,273 @@
+package installer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
+	"go.evanpurkhiser.com/dots/resolver"
+)
+
+func TestMergeLines(t *testing.T) {
+	testCases := []struct {
+		caseName  string
+		base      string
+		local     string
+		updated   string
+		merged    string
+		conflicts int
+	}{
+		{
+			caseName: "Only local changes",
+			base:     "a\nb\nc\n",
+			local:    "a\nB\nc\n",
+			updated:  "a\nb\nc\n",
+			merged:   "a\nB\nc\n",
+		},
+		{
+			caseName: "Only updated changes",
+			base:     "a\nb\nc\n",
+			local:    "a\nb\nc\n",
+			updated:  "a\nb\nc\nd\n",
+			merged:   "a\nb\nc\nd\n",
+		},
+		{
+			caseName: "Separate changes",
+			base:     "a\nb\nc\nd\ne\n",
+			local:    "A\nb\nc\nd\ne\n",
+			updated:  "a\nb\nc\nd\nE\n",
+			merged:   "A\nb\nc\nd\nE\n",
+		},
+		{
+			caseName: "Same change on both sides",
+			base:     "a\nb\nc\n",
+			local:    "a\nB\nc\n",
+			updated:  "a\nB\nc\n",
+			merged:   "a\nB\nc\n",
+		},
+		{
+			caseName:  "Conflicting changes",
+			base:      "a\nb\nc\n",
+			local:     "a\nlocal\nc\n",
+			updated:   "a\nupdated\nc\n",
+			merged:    "a\n<<<<<<< installed\nlocal\n=======\nupdated\n>>>>>>> sources\nc\n",
+			conflicts: 1,
+		},
+		{
+			caseName:  "Touching changes conflict",
+			base:      "a\nb\nc\nd\n",
+			local:     "a\nB\nc\nd\n",
+			updated:   "a\nb\nC\nd\n",
+			merged:    "a\n<<<<<<< installed\nB\nc\n=======\nb\nC\n>>>>>>> sources\nd\n",
+			conflicts: 1,
+		},
+		{
+			caseName:  "Common lines outside of conflict",
+			base:      "a\nb\nc\n",
+			local:     "A\nb\nc\n",
+			updated:   "A\nB\nc\n",
+			merged:    "A\n<<<<<<< installed\nb\n=======\nB\n>>>>>>> sources\nc\n",
+			conflicts: 1,
+		},
+		{
+			caseName:  "Unterminated conflicting lines",
+			base:      "a\nb",
+			local:     "a\nlocal",
+			updated:   "a\nupdated",
+			merged:    "a\n<<<<<<< installed\nlocal\n=======\nupdated\n>>>>>>> sources\n",
+			conflicts: 1,
+		},
+	}
+
+	for _, testCase := range testCases {
+		merged, conflicts := mergeLines(
+			splitLines([]byte(testCase.base)),
+			splitLines([]byte(testCase.local)),
+			splitLines([]byte(testCase.updated)),
+		)
+
+		if result := strings.Join(merged, ""); result != testCase.merged {
+			t.Errorf("Test %q expected merged = %q; got = %q", testCase.caseName, testCase.merged, result)
+		}
+
+		if conflicts != testCase.conflicts {
+			t.Errorf("Test %q expected conflicts = %d; got = %d", testCase.caseName, testCase.conflicts, conflicts)
+		}
+	}
+}
+
+func TestMergeInstall(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		local    string
+		source   string
+		markers  bool
+		merged   bool
+		expected string
+	}{
+		{
+			caseName: "Clean merge",
+			local:    "local\nb\nc\n",
+			source:   "a\nb\nsource\n",
+			merged:   true,
+			expected: "local\nb\nsource\n",
+		},
+		{
+			caseName: "Conflict left untouched",
+			local:    "a\nlocal\nc\n",
+			source:   "a\nsource\nc\n",
+			expected: "a\nlocal\nc\n",
+		},
+		{
+			caseName: "Conflict written with markers",
+			local:    "a\nlocal\nc\n",
+			source:   "a\nsource\nc\n",
+			markers:  true,
+			merged:   true,
+			expected: "a\n<<<<<<< installed\nlocal\n=======\nsource\n>>>>>>> sources\nc\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		root := t.TempDir()
+
+		sourceConfig := &config.SourceConfig{
+			SourcePath:   filepath.Join(root, "source"),
+			InstallPath:  filepath.Join(root, "home"),
+			LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+		}
+
+		sourcePath := filepath.Join(sourceConfig.SourcePath, "base", "bashrc")
+		installPath := filepath.Join(sourceConfig.InstallPath, "bashrc")
+
+		os.MkdirAll(filepath.Dir(sourcePath), 0755)
+		os.MkdirAll(sourceConfig.InstallPath, 0755)
+		os.WriteFile(sourcePath, []byte("a\nb\nc\n"), 0644)
+		os.WriteFile(installPath, []byte("a\nb\nc\n"), 0644)
+
+		dotfiles := resolver.Dotfiles{{
+			Path:    "bashrc",
+			Sources: []*resolver.SourceFile{{Group: "base", Path: "base/bashrc"}},
+		}}
+
+		lockfile := &config.SourceLockfile{InstalledFiles: []string{"bashrc"}}
+
+		installConfig := InstallConfig{
+			SourceConfig:    sourceConfig,
+			SourceLockfile:  lockfile,
+			ConflictMarkers: testCase.markers,
+		}
+
+		install := func() PreparedInstall {
+			prepared := PrepareDotfiles(dotfiles, *sourceConfig, *lockfile)
+			dotfile := prepared.Dotfiles[0]
+
+			if err := InstallDotfile(dotfile, installConfig); err != nil {
+				t.Fatalf("Test %q failed to install: %s", testCase.caseName, err)
+			}
+
+			installed := []*InstalledDotfile{{PreparedDotfile: dotfile}}
+
+			if err := FinalizeInstall(installed, installConfig); err != nil {
+				t.Fatalf("Test %q failed to finalize: %s", testCase.caseName, err)
+			}
+
+			return prepared
+		}
+
+		// The initial install records the base
+		install()
+
+		os.WriteFile(installPath, []byte(testCase.local), 0644)
+		os.WriteFile(sourcePath, []byte(testCase.source), 0644)
+
+		prepared := install()
+
+		if merged := IsMerged(prepared.Dotfiles[0], installConfig); merged != testCase.merged {
+			t.Errorf("Test %q expected IsMerged = %t", testCase.caseName, testCase.merged)
+		}
+
+		if data, _ := os.ReadFile(installPath); string(data) != testCase.expected {
+			t.Errorf("Test %q expected content = %q; got = %q", testCase.caseName, testCase.expected, data)
+		}
+
+		// Merged modifications are kept while the sources are unchanged
+		prepared = PrepareDotfiles(dotfiles, *sourceConfig, *lockfile)
+
+		if dotfile := prepared.Dotfiles[0]; testCase.merged && (dotfile.IsChanged() || dotfile.IsConflict()) {
+			t.Errorf("Test %q expected merged dotfile to be unchanged", testCase.caseName)
+		}
+	}
+}
+
+func TestMergeVariableChange(t *testing.T) {
+	root := t.TempDir()
+
+	sourceConfig := &config.SourceConfig{
+		SourcePath:   filepath.Join(root, "source"),
+		InstallPath:  filepath.Join(root, "home"),
+		LockfilePath: filepath.Join(root, "dots", "dotlock.json"),
+		Variables:    config.Variables{"font": 10},
+	}
+
+	sourcePath := filepath.Join(sourceConfig.SourcePath, "base", "termrc")
+	installPath := filepath.Join(sourceConfig.InstallPath, "termrc")
+
+	os.MkdirAll(filepath.Dir(sourcePath), 0755)
+	os.MkdirAll(sourceConfig.InstallPath, 0755)
+	os.WriteFile(sourcePath, []byte("font={{ .Vars.font }}\na\nb\nc\n"), 0644)
+
+	dotfiles := resolver.Dotfiles{{
+		Path:     "termrc",
+		Template: true,
+		Sources:  []*resolver.SourceFile{{Group: "base", Path: "base/termrc"}},
+	}}
+
+	lockfile := &config.SourceLockfile{}
+
+	installConfig := InstallConfig{
+		SourceConfig:   sourceConfig,
+		SourceLockfile: lockfile,
+	}
+
+	install := func() *PreparedDotfile {
+		dotfile := PrepareDotfiles(dotfiles, *sourceConfig, *lockfile).Dotfiles[0]
+
+		if err := InstallDotfile(dotfile, installConfig); err != nil {
+			t.Fatalf("Failed to install: %s", err)
+		}
+
+		installed := []*InstalledDotfile{{PreparedDotfile: dotfile}}
+
+		if err := FinalizeInstall(installed, installConfig); err != nil {
+			t.Fatalf("Failed to finalize: %s", err)
+		}
+
+		return dotfile
+	}
+
+	install()
+
+	// Merge local modifications with a change to the sources
+	os.WriteFile(installPath, []byte("font=10\na\nb\nlocal\n"), 0644)
+	os.WriteFile(sourcePath, []byte("font={{ .Vars.font }}\nsource\nb\nc\n"), 0644)
+
+	if dotfile := install(); !IsMerged(dotfile, installConfig) {
+		t.Fatalf("Expected local modifications to be merged")
+	}
+
+	// Only the variable changes, the sources are untouched
+	sourceConfig.Variables["font"] = 14
+
+	if dotfile := install(); !dotfile.IsChanged() {
+		t.Errorf("Expected the variable change to be installed")
+	}
+
+	expected := "font=14\nsource\nb\nlocal\n"
+
+	if data, _ := os.ReadFile(installPath); string(data) != expected {
+		t.Errorf("Expected content = %q; got = %q", expected, data)
+	}
+}
@@ -2,8 +2,11 @@ package installer
 
 import (
 	"bytes"
+	"fmt"
 	"os"
 	"regexp"
+
+	"go.evanpurkhiser.com/dots/config"
 )
 
 var shebangRegex = regexp.MustCompile("^#!.*\n")
@@ -20,7 +23,16 @@ func trimWhitespace(d []byte) []byte {
 
 var envGetter = os.Getenv
 
-// expandEnvironment replaces environment variables.
-func expandEnvironment(d []byte) []byte {
-	return []byte(os.Expand(string(d), envGetter))
+// expandEnvironment replaces environment variables. Variables that exist in
+// the vars mapping are replaced with the variable value instead.
+func expandEnvironment(d []byte, vars config.Variables) []byte {
+	mapping := func(key string) string {
+		if value, ok := vars[key]; ok {
+			return fmt.Sprint(value)
+		}
+
+		return envGetter(key)
+	}
+
+	return []byte(os.Expand(string(d), mapping))
 }
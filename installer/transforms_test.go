@@ -2,6 +2,8 @@ package installer
 
 import (
 	"testing"
+
+	"go.evanpurkhiser.com/dots/config"
 )
 
 func TestTrimWhitespace(t *testing.T) {
@@ -43,6 +45,12 @@ func TestTrimShebang(t *testing.T) {
 func TestExpandEnvironment(t *testing.T) {
 	envMap := map[string]string{
 		"VARIABLE": "myVariable",
+		"SHADOWED": "envVariable",
+	}
+
+	vars := config.Variables{
+		"SHADOWED":  "userVariable",
+		"font_size": 12,
 	}
 
 	testCases := []struct {
@@ -51,6 +59,8 @@ func TestExpandEnvironment(t *testing.T) {
 	}{
 		{"Testing ${VARIABLE}", "Testing myVariable"},
 		{"testing ${INVALID}", "testing "},
+		{"Testing ${SHADOWED}", "Testing userVariable"},
+		{"size=${font_size}", "size=12"},
 	}
 
 	origEnvGetter := envGetter
@@ -61,7 +71,7 @@ func TestExpandEnvironment(t *testing.T) {
 	}
 
 	for _, testCase := range testCases {
-		actual := expandEnvironment([]byte(testCase.input))
+		actual := expandEnvironment([]byte(testCase.input), vars)
 
 		if string(actual) != testCase.expected {
 			t.Errorf("Expected string = %s; got string = %s", testCase.expected, actual)
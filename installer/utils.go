@@ -2,34 +2,35 @@ package installer
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"os"
 )
 
 // flattenPermissions takes a list of objects implementing the os.FileInfo
 // interface and flattens the permissions into a single FileMode. If any of the
-// permissions differ, it will flatten the permission to into the lowest (least
-// permissive) permission and set the boolean return value to true.
-func flattenPermissions(infos []os.FileInfo) (m os.FileMode, tookLowest bool) {
+// permissions differ, it will flatten the permissions into the least
+// permissive mode, granting only the permissions common to all modes, and set
+// the boolean return value to true.
+func flattenPermissions(infos []os.FileInfo) (m os.FileMode, differ bool) {
 	if len(infos) < 1 {
 		return 0, false
 	}
 
-	lowestMode := infos[0].Mode() & os.ModePerm
+	commonMode := infos[0].Mode() & os.ModePerm
 
 	for _, stat := range infos[1:] {
 		mode := stat.Mode() & os.ModePerm
 
-		if mode != lowestMode {
-			tookLowest = true
+		if mode != commonMode {
+			differ = true
 		}
 
-		if mode < lowestMode {
-			lowestMode = mode
-		}
+		commonMode &= mode
 	}
 
-	return lowestMode, tookLowest
+	return commonMode, differ
 }
 
 // isAllRegular checks that a list of objects implementing the os.FileInfo
@@ -47,6 +48,20 @@ func isAllRegular(infos []os.FileInfo) bool {
 	return allRegular
 }
 
+// binarySniffLength is the number of leading bytes inspected when detecting
+// binary data.
+const binarySniffLength = 8000
+
+// isBinary reports if the data appears to be binary. Data containing a NUL
+// byte within its leading bytes is considered binary.
+func isBinary(d []byte) bool {
+	if len(d) > binarySniffLength {
+		d = d[:binarySniffLength]
+	}
+
+	return bytes.IndexByte(d, 0) != -1
+}
+
 const chunkSize = 4096
 
 // compareReaders compares two io.Readers for differences.
@@ -74,3 +89,10 @@ func compareReaders(file1, file2 io.Reader) (bool, error) {
 		}
 	}
 }
+
+// hashContents returns the hex encoded sha256 of the data.
+func hashContents(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
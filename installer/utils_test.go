@@ -1,6 +1,7 @@
 package installer
 
 import (
+	"bytes"
 	"os"
 	"testing"
 	"time"
@@ -17,10 +18,10 @@ func (m modeStub) Sys() interface{}   { return nil }
 
 func TestFlattenPermissions(t *testing.T) {
 	testCases := []struct {
-		caseName         string
-		modes            []os.FileMode
-		expectedMode     os.FileMode
-		shouldTakeLowest bool
+		caseName     string
+		modes        []os.FileMode
+		expectedMode os.FileMode
+		shouldDiffer bool
 	}{
 		{
 			caseName: "All same permissions",
@@ -29,8 +30,8 @@ func TestFlattenPermissions(t *testing.T) {
 				0777,
 				0777,
 			},
-			expectedMode:     0777,
-			shouldTakeLowest: false,
+			expectedMode: 0777,
+			shouldDiffer: false,
 		},
 		{
 			caseName: "Differing permissions",
@@ -39,8 +40,17 @@ func TestFlattenPermissions(t *testing.T) {
 				0644,
 				0777,
 			},
-			expectedMode:     0644,
-			shouldTakeLowest: true,
+			expectedMode: 0644,
+			shouldDiffer: true,
+		},
+		{
+			caseName: "Numerically lower permissions are not less permissive",
+			modes: []os.FileMode{
+				0700,
+				0644,
+			},
+			expectedMode: 0600,
+			shouldDiffer: true,
 		},
 		{
 			caseName: "Ignore extra modes",
@@ -49,8 +59,8 @@ func TestFlattenPermissions(t *testing.T) {
 				os.ModePerm&0644 | os.ModeCharDevice,
 				os.ModePerm&0644 | os.ModeDir,
 			},
-			expectedMode:     os.ModePerm & 0644,
-			shouldTakeLowest: false,
+			expectedMode: os.ModePerm & 0644,
+			shouldDiffer: false,
 		},
 	}
 
@@ -61,14 +71,49 @@ func TestFlattenPermissions(t *testing.T) {
 			infos[i] = modeStub(mode)
 		}
 
-		mode, tookLowest := flattenPermissions(infos)
+		mode, differ := flattenPermissions(infos)
 
 		if mode != testCase.expectedMode {
-			t.Errorf("Expected mode = %s; got mode = %s", mode, testCase.expectedMode)
+			t.Errorf("Expected mode = %s; got mode = %s, %s", testCase.expectedMode, mode, testCase.caseName)
 		}
 
-		if tookLowest != testCase.shouldTakeLowest {
-			t.Errorf("Expected tookLowest = %t, %s", testCase.shouldTakeLowest, testCase.caseName)
+		if differ != testCase.shouldDiffer {
+			t.Errorf("Expected differ = %t, %s", testCase.shouldDiffer, testCase.caseName)
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	testCases := []struct {
+		caseName string
+		data     []byte
+		expected bool
+	}{
+		{
+			caseName: "Empty data",
+			data:     []byte{},
+			expected: false,
+		},
+		{
+			caseName: "Text data",
+			data:     []byte("set -o vi\n"),
+			expected: false,
+		},
+		{
+			caseName: "NUL byte",
+			data:     []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"),
+			expected: true,
+		},
+		{
+			caseName: "NUL byte past sniff length",
+			data:     append(bytes.Repeat([]byte("a"), binarySniffLength), 0),
+			expected: false,
+		},
+	}
+
+	for _, testCase := range testCases {
+		if actual := isBinary(testCase.data); actual != testCase.expected {
+			t.Errorf("Expected = %v; got = %v, %s", testCase.expected, actual, testCase.caseName)
 		}
 	}
 }
@@ -2,6 +2,7 @@ package output
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/fatih/color"
@@ -33,8 +34,8 @@ func New(config Config) *Output {
 	// Get the max length of the groups
 	maxDotfileLength := 0
 	for _, d := range config.PreparedInstall.Dotfiles {
-		if logger.shouldLogDotfile(d) && len(d.Path) > maxDotfileLength {
-			maxDotfileLength = len(d.Path)
+		if logger.shouldLogDotfile(d) && len(d.DisplayPath()) > maxDotfileLength {
+			maxDotfileLength = len(d.DisplayPath())
 		}
 	}
 	logger.maxDotfileLength = maxDotfileLength
@@ -53,7 +54,11 @@ type Output struct {
 // shouldLogDotfile indicates if the dotfile should be logged given the current
 // Output configuration.
 func (l *Output) shouldLogDotfile(dotfile *installer.PreparedDotfile) bool {
-	return dotfile.PrepareError != nil || installer.WillInstallDotfile(dotfile, l.InstallConfig)
+	return dotfile.PrepareError != nil ||
+		dotfile.Suppressed ||
+		dotfile.IsConflict() ||
+		len(dotfile.CompileWarnings) > 0 ||
+		installer.WillInstallDotfile(dotfile, l.InstallConfig)
 }
 
 func (l *Output) logEvent(event events.Event) {
@@ -106,16 +111,30 @@ func (l *Output) InstallInfo() {
 	}
 
 	fmt.Printf(
-		"%s %s added %s removed %s modified %s error\n",
+		"%s %s added %s removed %s modified %s locally modified %s error\n",
 		color.HiBlackString("legend:"),
 		color.HiGreenString("◼️"),
 		color.HiRedString("◼️"),
 		color.HiBlueString("◼️"),
+		color.HiMagentaString("◼️"),
 		color.HiRedString("⨉"),
 	)
 
 	fmt.Printf("%s %s\n", color.HiBlackString("source:"), l.SourceConfig.SourcePath)
 	fmt.Printf("%s %s\n", color.HiBlackString("target:"), l.SourceConfig.InstallPath)
+
+	targets := make([]string, 0, len(l.SourceConfig.Targets))
+
+	for name := range l.SourceConfig.Targets {
+		targets = append(targets, name)
+	}
+
+	sort.Strings(targets)
+
+	for _, name := range targets {
+		fmt.Printf("%s %s\n", color.HiBlackString(name+":"), l.SourceConfig.Targets[name].Path)
+	}
+
 	fmt.Println()
 }
 
@@ -138,6 +157,8 @@ func (l *Output) DotfileInfo(dotfile *installer.PreparedDotfile) {
 	case dotfile.PrepareError != nil:
 		indicator = "⨉"
 		indicatorColor.Add(color.FgRed)
+	case dotfile.LocallyModified:
+		indicatorColor.Add(color.FgHiMagenta)
 	case dotfile.IsNew:
 		indicatorColor.Add(color.FgHiGreen)
 	case dotfile.Removed:
@@ -149,13 +170,15 @@ func (l *Output) DotfileInfo(dotfile *installer.PreparedDotfile) {
 		indicatorColor.Add(color.FgHiBlack)
 	}
 
+	sources := dotfile.ActiveSources()
+
 	group := ""
-	if len(dotfile.Sources) == 1 {
-		group = dotfile.Sources[0].Group
+	if len(sources) == 1 {
+		group = sources[0].Group
 	} else {
-		groups := make([]string, 0, len(dotfile.Sources))
+		groups := make([]string, 0, len(sources))
 
-		for _, source := range dotfile.Sources {
+		for _, source := range sources {
 			groups = append(groups, source.Group)
 		}
 
@@ -173,7 +196,7 @@ func (l *Output) DotfileInfo(dotfile *installer.PreparedDotfile) {
 	fmt.Printf(
 		output,
 		indicatorColor.Sprint(indicator),
-		dotfile.Path,
+		dotfile.DisplayPath(),
 		group,
 	)
 
@@ -200,11 +223,88 @@ func (l *Output) DotfileInfo(dotfile *installer.PreparedDotfile) {
 		ln(w, "overwriting existing file")
 	}
 
+	switch {
+	case dotfile.LocallyModified && dotfile.SourcesChanged:
+		ln(w, "modified locally since the last install, sources have also changed")
+	case dotfile.LocallyModified:
+		ln(w, "modified locally since the last install, sources are unchanged")
+	}
+
+	if dotfile.IsConflict() {
+		switch l.InstallConfig.Conflicts {
+		case installer.ConflictSkip:
+			switch {
+			case dotfile.Merge == nil:
+				ln(w, "conflict, skipped to keep local modifications")
+			case dotfile.Merge.Conflicts == 0:
+				ln(n, "local modifications merged with changes to the sources")
+			case l.InstallConfig.ConflictMarkers:
+				ln(w, fmt.Sprintf("merged with %d conflicts, marked in the dotfile", dotfile.Merge.Conflicts))
+			default:
+				ln(w, fmt.Sprintf("merge has %d conflicts, skipped to keep local modifications", dotfile.Merge.Conflicts))
+			}
+		case installer.ConflictKeep:
+			ln(n, "local version kept")
+		case installer.ConflictBackup:
+			ln(n, "local version saved in the backup run")
+		}
+	}
+
+	if dotfile.IsSymlink() {
+		ln(n, fmt.Sprintf("symlink to %s", dotfile.LinkTarget))
+	}
+
+	if dotfile.InstallMode == config.InstallLink && !dotfile.IsSymlink() && !dotfile.Removed {
+		reason := "dotfile must be compiled"
+		if dotfile.Mode != 0 {
+			reason = "dotfile declares a mode"
+		}
+
+		ln(n, "copied instead of linked, "+reason)
+	}
+
+	for _, warning := range dotfile.CompileWarnings {
+		ln(w, warning)
+	}
+
 	if dotfile.SourcePermissionsDiffer {
 		ln(w, "inconsistent source file permissions")
 	}
 
+	if dotfile.Permissions.IsDrifted() {
+		ln(n, fmt.Sprintf("mode drifted from the declared mode %#o", int(dotfile.Permissions.New)))
+	}
+
+	dirs := make([]string, 0, len(dotfile.DirectoryPermissions))
+
+	for dir, mode := range dotfile.DirectoryPermissions {
+		if mode.IsChanged() {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		mode := dotfile.DirectoryPermissions[dir]
+		ln(n, fmt.Sprintf("directory %s mode %#o → %#o", dir, int(mode.Old), int(mode.New)))
+	}
+
 	if dotfile.RemovedNull {
 		ln(n, "nothing to remove")
 	}
+
+	if dotfile.Suppressed {
+		ln(n, fmt.Sprintf("suppressed by %s", dotfile.SuppressedBy))
+	}
+
+	if discarded, overriddenBy := dotfile.DiscardedSources(); len(discarded) > 0 {
+		paths := make([]string, 0, len(discarded))
+
+		for _, source := range discarded {
+			paths = append(paths, source.Path)
+		}
+
+		ln(n, fmt.Sprintf("discarded %s, overridden by %s", strings.Join(paths, ", "), overriddenBy.Path))
+	}
 }
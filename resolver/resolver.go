@@ -1,6 +1,7 @@
 package resolver
 
 import (
+	"maps"
 	"os"
 	"path/filepath"
 	"sort"
@@ -17,6 +18,14 @@ type SourceFile struct {
 	Group    string
 	Path     string
 	Override bool
+
+	// Template indicates that the source file is a Go text/template that will
+	// be rendered before being compiled into the dotfile.
+	Template bool
+
+	// Patch indicates that the source file is a unified diff that will be
+	// applied to the compiled output of the sources before it.
+	Patch bool
 }
 
 // Dotfile represents a file to be installed.
@@ -32,10 +41,77 @@ type Dotfile struct {
 	// installed dotfiles and will be added.
 	Added bool
 
+	// Suppressed indicates that the dotfile was removed from the cascade by a
+	// whiteout file in a higher group. A suppressed dotfile has no sources and
+	// will not be installed. If it was previously installed it will also be
+	// marked as Removed.
+	Suppressed bool
+
+	// SuppressedBy is the source path of the whiteout file which suppressed
+	// the dotfile.
+	SuppressedBy string
+
 	// ExpandEnv indicates that the dotfile will have environments within the
 	// source content expanded.
 	ExpandEnv bool
 
+	// Template indicates that all sources of the dotfile will be rendered as
+	// Go text/templates.
+	Template bool
+
+	// PreserveWhitespace indicates that the sources of the dotfile will not
+	// have whitespace or shebangs normalized when they are combined.
+	PreserveWhitespace bool
+
+	// MergeStrategy specifies how multiple sources of the dotfile will be
+	// combined together.
+	MergeStrategy config.MergeStrategy
+
+	// Mode specifies the permissions the dotfile will be installed with. When
+	// zero the permissions are determined from the sources.
+	Mode os.FileMode
+
+	// DirectoryModes maps the parent directories of the dotfile to the
+	// permissions specified for them by file rules.
+	DirectoryModes map[string]os.FileMode
+
+	// InstallMode specifies how the dotfile will be installed. Dotfiles
+	// without an install mode are copied.
+	InstallMode config.InstallMode
+
+	// InstallTarget is the name of the install target the dotfile is installed
+	// into. Dotfiles of the default, unnamed, target are installed into the
+	// install path.
+	InstallTarget string
+
+	// ManagedLink indicates that the dotfile is a link declared in the
+	// configuration. Managed links have no sources, their path is absolute,
+	// and they are installed as a symlink to the installed LinkedDotfile.
+	ManagedLink bool
+
+	// LinkedDotfile is the path of the installed dotfile a managed link
+	// points at, relative to the install path.
+	LinkedDotfile string
+
+	// OriginalPath is the path of the dotfile within the source groups when a
+	// file rule or install target has changed the path the dotfile is
+	// installed to.
+	OriginalPath string
+
+	// Collision is the path a file rule or install target would have moved
+	// the dotfile to, which is claimed by another dotfile. The dotfile is
+	// left at its path within the source groups.
+	Collision string
+
+	// CollidesWith is the path within the source groups of the dotfile which
+	// claimed the path of the collision. It is empty when no dotfile is
+	// installed there, as the claiming dotfile itself collided.
+	CollidesWith string
+
+	// Rules is the list of indexes of the file rules which matched the
+	// dotfile, in the order they were applied.
+	Rules []int
+
 	// Sources is the set of SourceFiles
 	Sources []*SourceFile
 
@@ -44,6 +120,50 @@ type Dotfile struct {
 	InstallScripts []string
 }
 
+// DisplayPath returns the path of the dotfile, prefixed by the name of its
+// install target when it is not installed into the install path.
+func (d *Dotfile) DisplayPath() string {
+	if d.InstallTarget == "" {
+		return d.Path
+	}
+
+	return d.InstallTarget + ":" + d.Path
+}
+
+// overrideIndex returns the index of the last override source, or -1 if the
+// dotfile has no override sources.
+func (d *Dotfile) overrideIndex() int {
+	for i := len(d.Sources) - 1; i >= 0; i-- {
+		if d.Sources[i].Override {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// ActiveSources returns the sources that will be compiled into the dotfile.
+// Any sources lower in the cascade than the last override source are
+// discarded.
+func (d *Dotfile) ActiveSources() []*SourceFile {
+	if index := d.overrideIndex(); index > 0 {
+		return d.Sources[index:]
+	}
+
+	return d.Sources
+}
+
+// DiscardedSources returns the sources that will not be compiled into the
+// dotfile, along with the override source that discarded them.
+func (d *Dotfile) DiscardedSources() ([]*SourceFile, *SourceFile) {
+	index := d.overrideIndex()
+	if index < 1 {
+		return nil, nil
+	}
+
+	return d.Sources[:index], d.Sources[index]
+}
+
 // Dotfiles holds a list of Dotfiles.
 type Dotfiles []*Dotfile
 
@@ -52,6 +172,10 @@ func (d Dotfiles) Files() []string {
 	files := []string{}
 
 	for _, dotfile := range d {
+		if dotfile.Suppressed {
+			continue
+		}
+
 		path := dotfile.Path
 		files = append(files, path)
 	}
@@ -60,7 +184,7 @@ func (d Dotfiles) Files() []string {
 }
 
 // Filter filters down a Dotfiles list to only dotfiles with the specified
-// prefixes.
+// prefixes. Dotfiles which have been moved also match by their original path.
 func (d Dotfiles) Filter(prefixes []string) Dotfiles {
 	if len(prefixes) == 0 {
 		return d
@@ -77,6 +201,11 @@ func (d Dotfiles) Filter(prefixes []string) Dotfiles {
 				filtered = false
 				break
 			}
+
+			if dotfile.OriginalPath != "" && strings.HasPrefix(dotfile.OriginalPath, prefix) {
+				filtered = false
+				break
+			}
 		}
 
 		if !filtered {
@@ -91,29 +220,36 @@ func (d Dotfiles) Filter(prefixes []string) Dotfiles {
 // dotfiles is a package internal type used to construct the final list.
 type dotfileMap map[string]*Dotfile
 
-// asList constructs a Dotfiles object in order by the paths of the dotfiles.
+// asList constructs a Dotfiles object in order by the install target and paths
+// of the dotfiles. Dotfiles of the default install target are first, and
+// managed links are last.
 func (d dotfileMap) asList() Dotfiles {
-	paths := make([]string, 0, len(d))
+	dotfiles := make(Dotfiles, 0, len(d))
 
-	for path := range d {
-		paths = append(paths, path)
+	for _, dotfile := range d {
+		dotfiles = append(dotfiles, dotfile)
 	}
 
-	sort.Strings(paths)
+	sort.Slice(dotfiles, func(i, j int) bool {
+		if dotfiles[i].ManagedLink != dotfiles[j].ManagedLink {
+			return dotfiles[j].ManagedLink
+		}
 
-	dotfiles := Dotfiles{}
+		if dotfiles[i].InstallTarget != dotfiles[j].InstallTarget {
+			return dotfiles[i].InstallTarget < dotfiles[j].InstallTarget
+		}
 
-	for _, path := range paths {
-		dotfiles = append(dotfiles, d[path])
-	}
+		return dotfiles[i].Path < dotfiles[j].Path
+	})
 
 	return dotfiles
 }
 
 // resolveSources inserts or updates a dotfiles map from a list of
 // dotfile sources relative to the source root. Sources not belonging to the
-// specified group will be ignored.
-func resolveSources(dotfiles dotfileMap, sources, oldDotfiles []string, group string) {
+// specified group will be ignored. Sources ending in the templateSuffix will be
+// marked as templates and have the suffix removed from the dotfile path.
+func resolveSources(dotfiles dotfileMap, sources, oldDotfiles []string, group, templateSuffix string) {
 	for _, source := range sources {
 		if !strings.HasPrefix(source, group) {
 			continue
@@ -126,6 +262,11 @@ func resolveSources(dotfiles dotfileMap, sources, oldDotfiles []string, group st
 			Path:  source,
 		}
 
+		if templateSuffix != "" && strings.HasSuffix(destPath, templateSuffix) {
+			destPath = strings.TrimSuffix(destPath, templateSuffix)
+			sourceFile.Template = true
+		}
+
 		// The dotfle file was added in a previous group mapping
 		if file, ok := dotfiles[destPath]; ok {
 			file.Sources = append(file.Sources, sourceFile)
@@ -200,6 +341,90 @@ func resolveOverrides(dotfiles dotfileMap, overrideSuffix string) {
 	}
 }
 
+// resolvePatches looks for dotfiles ending in the patchSuffix and appends their
+// sources as patch sources of the dotfile they are named after. Patches which
+// have no dotfile to patch are kept as a dotfile of only patch sources, which
+// will fail to compile unless the patch creates the file.
+func resolvePatches(dotfiles dotfileMap, patchSuffix string, lockfile config.SourceLockfile) {
+	patches := []string{}
+
+	for path := range dotfiles {
+		if strings.HasSuffix(path, patchSuffix) {
+			patches = append(patches, path)
+		}
+	}
+
+	for _, path := range patches {
+		dotfile := dotfiles[path]
+
+		for _, source := range dotfile.Sources {
+			source.Patch = true
+		}
+
+		delete(dotfiles, path)
+
+		targetPath := strings.TrimSuffix(path, patchSuffix)
+
+		if target, ok := dotfiles[targetPath]; ok {
+			target.Sources = append(target.Sources, dotfile.Sources...)
+			continue
+		}
+
+		dotfile.Path = targetPath
+		dotfile.Added = !inList(lockfile.InstalledFiles, targetPath)
+		dotfiles[targetPath] = dotfile
+	}
+}
+
+// resolveWhiteouts looks for dotfiles ending in the removeSuffix and removes
+// the dotfile they are named after, along with any dotfiles within the
+// directory they are named after. The removed dotfile paths are recorded in the
+// suppressed map along with the whiteout source that removed them.
+func resolveWhiteouts(dotfiles dotfileMap, suppressed map[string]string, removeSuffix string) {
+	whiteouts := map[string]string{}
+
+	for path, dotfile := range dotfiles {
+		if !strings.HasSuffix(path, removeSuffix) {
+			continue
+		}
+
+		whiteouts[strings.TrimSuffix(path, removeSuffix)] = dotfile.Sources[len(dotfile.Sources)-1].Path
+		delete(dotfiles, path)
+	}
+
+	for whiteoutPath, sourcePath := range whiteouts {
+		for path := range dotfiles {
+			if path != whiteoutPath && !strings.HasPrefix(path, whiteoutPath+separator) {
+				continue
+			}
+
+			suppressed[path] = sourcePath
+			delete(dotfiles, path)
+		}
+	}
+}
+
+// resolveSuppressed inserts entries into a dotfiles map for files that were
+// suppressed by a whiteout and were not added back by a higher group.
+func resolveSuppressed(dotfiles dotfileMap, suppressed map[string]string, conf config.SourceConfig, lockfile config.SourceLockfile) {
+	for path, sourcePath := range suppressed {
+		target, targetPath := conf.TargetDirectory(path)
+		key := dotfileKey(target, targetPath)
+
+		if _, ok := dotfiles[key]; ok {
+			continue
+		}
+
+		dotfiles[key] = &Dotfile{
+			Path:          targetPath,
+			InstallTarget: target,
+			Removed:       inList(lockfile.InstalledPaths(target), targetPath),
+			Suppressed:    true,
+			SuppressedBy:  sourcePath,
+		}
+	}
+}
+
 // resolveInstallScripts looks for dotfiles ending in the installSuffix and will map
 // them to the dotfile they are named after, or any dotfile's that exist within
 // the directory they are named after.
@@ -235,16 +460,57 @@ func resolveInstallScripts(dotfiles dotfileMap, installSuffix string) {
 }
 
 // resolveRemoved inserts entries into a dotfiles map for files that previously
-// were installed but are no longer present to be installed.
-func resolveRemoved(dotfiles dotfileMap, oldDotfiles []string) {
-	for _, oldDotfile := range oldDotfiles {
-		if _, ok := dotfiles[oldDotfile]; ok {
+// were installed, into any install target, but are no longer present to be
+// installed. Targets without a known path are ignored.
+func resolveRemoved(dotfiles dotfileMap, conf config.SourceConfig, lockfile config.SourceLockfile) {
+	targets := []string{""}
+
+	for target := range lockfile.InstalledTargets {
+		if lockfile.TargetPath(conf, target) != "" {
+			targets = append(targets, target)
+		}
+	}
+
+	for _, target := range targets {
+		for _, oldDotfile := range lockfile.InstalledPaths(target) {
+			key := dotfileKey(target, oldDotfile)
+
+			if _, ok := dotfiles[key]; ok {
+				continue
+			}
+
+			dotfiles[key] = &Dotfile{
+				Path:          oldDotfile,
+				InstallTarget: target,
+				Removed:       true,
+			}
+		}
+	}
+}
+
+// resolveLinks inserts managed links into the dotfiles map. Managed links are
+// keyed by their absolute path, which never collides with the relative path of
+// a dotfile. Links which were previously installed but are no longer declared
+// are marked as removed.
+func resolveLinks(dotfiles dotfileMap, links map[string]string, oldLinks []string) {
+	for link, dotfilePath := range links {
+		dotfiles[link] = &Dotfile{
+			Path:          link,
+			Added:         !inList(oldLinks, link),
+			ManagedLink:   true,
+			LinkedDotfile: dotfilePath,
+		}
+	}
+
+	for _, oldLink := range oldLinks {
+		if _, ok := dotfiles[oldLink]; ok {
 			continue
 		}
 
-		dotfiles[oldDotfile] = &Dotfile{
-			Path:    oldDotfile,
-			Removed: true,
+		dotfiles[oldLink] = &Dotfile{
+			Path:        oldLink,
+			Removed:     true,
+			ManagedLink: true,
 		}
 	}
 }
@@ -259,6 +525,284 @@ func resolveExpandEnv(dotfiles dotfileMap, expandPaths []string) {
 	}
 }
 
+func resolveTemplates(dotfiles dotfileMap, templatePaths []string) {
+	for _, templateTarget := range templatePaths {
+		if dotfile, ok := dotfiles[templateTarget]; ok {
+			dotfile.Template = true
+		}
+	}
+}
+
+func resolvePreserveWhitespace(dotfiles dotfileMap, preservePaths []string) {
+	for _, preserveTarget := range preservePaths {
+		if dotfile, ok := dotfiles[preserveTarget]; ok {
+			dotfile.PreserveWhitespace = true
+		}
+	}
+}
+
+// extensionStrategies maps file extensions to their structured merge strategy.
+var extensionStrategies = map[string]config.MergeStrategy{
+	".json": config.MergeJSON,
+	".yaml": config.MergeYAML,
+	".yml":  config.MergeYAML,
+	".toml": config.MergeTOML,
+	".ini":  config.MergeINI,
+}
+
+// resolveMergeStrategies determines the merge strategy of dotfiles with
+// multiple sources. The strategy is determined by the file extension, unless
+// explicitly configured in the strategies mapping.
+func resolveMergeStrategies(dotfiles dotfileMap, strategies map[string]config.MergeStrategy) {
+	for path, dotfile := range dotfiles {
+		if len(dotfile.ActiveSources()) < 2 {
+			continue
+		}
+
+		strategy, ok := strategies[path]
+		if !ok {
+			strategy, ok = extensionStrategies[strings.ToLower(filepath.Ext(path))]
+		}
+
+		if ok && strategy != config.MergeConcat {
+			dotfile.MergeStrategy = strategy
+		}
+	}
+}
+
+func resolveInstallMode(dotfiles dotfileMap, mode config.InstallMode) {
+	if mode == "" {
+		return
+	}
+
+	for _, dotfile := range dotfiles {
+		dotfile.InstallMode = mode
+	}
+}
+
+// applicableRules determines which file rules have conditions matching the
+// facts. Rules with conditions that do not match are skipped.
+func applicableRules(rules []config.FileRule, facts config.Facts) []bool {
+	applicable := make([]bool, len(rules))
+
+	for i, rule := range rules {
+		applicable[i], _ = rule.MatchesFacts(facts)
+	}
+
+	return applicable
+}
+
+// installLocation is the install target, and path within the target, that a
+// file rule places a dotfile at. Empty values leave the dotfile unchanged.
+type installLocation struct {
+	target string
+	path   string
+}
+
+// resolveFileRules applies the options of each applicable file rule to the
+// dotfiles matching the rule. Rules are applied in order, with later rules
+// taking precedence. The install locations requested by rules are returned.
+func resolveFileRules(dotfiles dotfileMap, rules []config.FileRule, applicable []bool) map[string]installLocation {
+	locations := map[string]installLocation{}
+
+	for path, dotfile := range dotfiles {
+		for i, rule := range rules {
+			if !applicable[i] || !rule.Matches(path) {
+				continue
+			}
+
+			dotfile.Rules = append(dotfile.Rules, i)
+
+			if mode, _ := rule.FileMode(); mode != 0 {
+				dotfile.Mode = mode
+			}
+
+			if rule.ExpandEnvironment != nil {
+				dotfile.ExpandEnv = *rule.ExpandEnvironment
+			}
+
+			if rule.Template != nil {
+				dotfile.Template = *rule.Template
+			}
+
+			if rule.PreserveWhitespace != nil {
+				dotfile.PreserveWhitespace = *rule.PreserveWhitespace
+			}
+
+			if rule.Merge != "" && len(dotfile.ActiveSources()) > 1 {
+				dotfile.MergeStrategy = rule.Merge
+
+				if rule.Merge == config.MergeConcat {
+					dotfile.MergeStrategy = ""
+				}
+			}
+
+			if rule.InstallMode != "" {
+				dotfile.InstallMode = rule.InstallMode
+			}
+
+			location := locations[path]
+
+			if rule.Target != "" {
+				location.path = rule.TargetPath(path)
+			}
+
+			if rule.InstallTarget != "" {
+				location.target = rule.InstallTarget
+			}
+
+			locations[path] = location
+		}
+	}
+
+	return locations
+}
+
+// dotfileKey is the key of a dotfile within a dotfileMap. Dotfiles of the
+// default install target are keyed by their path.
+func dotfileKey(target, path string) string {
+	if target == "" {
+		return path
+	}
+
+	return target + "\x00" + path
+}
+
+// resolveInstallTargets moves dotfiles within the directory of an install
+// target into the target, along with dotfiles placed elsewhere by file rules.
+// A dotfile is not moved onto a path claimed by another dotfile, one which is
+// left at that path or moved there from a source path sorted before it, and
+// the collision is recorded on the dotfile. Destinations are resolved
+// together, such that the dotfile claiming a path does not depend on the
+// order dotfiles are moved in.
+func resolveInstallTargets(dotfiles dotfileMap, conf config.SourceConfig, locations map[string]installLocation, lockfile config.SourceLockfile) {
+	paths := make([]string, 0, len(dotfiles))
+
+	for path := range dotfiles {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	destinations := map[string]installLocation{}
+	unmoved := map[string]bool{}
+
+	for _, path := range paths {
+		target, targetPath := conf.TargetDirectory(path)
+		location := locations[path]
+
+		if location.target != "" {
+			target = location.target
+		}
+
+		if location.path != "" {
+			targetPath = location.path
+		}
+
+		destinations[path] = installLocation{target: target, path: targetPath}
+		unmoved[path] = dotfileKey(target, targetPath) == path
+	}
+
+	// Dotfiles which are not moved keep their path, which may in turn be the
+	// destination of another dotfile, so claims are made again until no
+	// dotfile collides.
+	claimed := map[string]string{}
+	collisions := map[string]string{}
+
+	for collided := true; collided; {
+		collided = false
+		clear(claimed)
+
+		for _, path := range paths {
+			if unmoved[path] {
+				claimed[path] = path
+			}
+		}
+
+		for _, path := range paths {
+			destination := destinations[path]
+			key := dotfileKey(destination.target, destination.path)
+
+			if unmoved[path] {
+				continue
+			}
+
+			if _, exists := claimed[key]; exists {
+				unmoved[path] = true
+				collisions[path] = key
+				collided = true
+				continue
+			}
+
+			claimed[key] = path
+		}
+	}
+
+	for key, path := range claimed {
+		if key == path {
+			continue
+		}
+
+		destination := destinations[path]
+
+		dotfile := dotfiles[path]
+		dotfile.OriginalPath = path
+		dotfile.Path = destination.path
+		dotfile.InstallTarget = destination.target
+		dotfile.Added = !inList(lockfile.InstalledPaths(destination.target), destination.path)
+	}
+
+	for path, key := range collisions {
+		destination := destinations[path]
+
+		dotfile := dotfiles[path]
+		dotfile.Collision = (&Dotfile{Path: destination.path, InstallTarget: destination.target}).DisplayPath()
+		dotfile.CollidesWith = claimed[key]
+	}
+
+	moved := dotfileMap{}
+
+	for key, path := range claimed {
+		moved[key] = dotfiles[path]
+	}
+
+	clear(dotfiles)
+	maps.Copy(dotfiles, moved)
+}
+
+// resolveDirectoryModes applies the directory modes of file rules to the
+// parent directories of the installed dotfile, which are only known once
+// dotfiles have been moved.
+func resolveDirectoryModes(dotfiles dotfileMap, rules []config.FileRule, applicable []bool) {
+	for _, dotfile := range dotfiles {
+		for dir := filepath.Dir(dotfile.Path); dir != "."; dir = filepath.Dir(dir) {
+			for i, rule := range rules {
+				mode, _ := rule.DirectoryFileMode()
+
+				if !applicable[i] || mode == 0 || !rule.Matches(dir) {
+					continue
+				}
+
+				if dotfile.DirectoryModes == nil {
+					dotfile.DirectoryModes = map[string]os.FileMode{}
+				}
+
+				dotfile.DirectoryModes[dir] = mode
+			}
+		}
+	}
+}
+
+func inList(list []string, item string) bool {
+	for _, listItem := range list {
+		if listItem == item {
+			return true
+		}
+	}
+
+	return false
+}
+
 // sourceLoader provides a list of files given a source path.
 var sourceLoader = func(sourcePath string) []string {
 	sources := []string{}
@@ -287,18 +831,59 @@ func ResolveDotfiles(conf config.SourceConfig, lockfile config.SourceLockfile) D
 	sources := sourceLoader(conf.SourcePath)
 	groups := lockfile.ResolveGroups(conf)
 
+	templateSuffix := ""
+	if conf.TemplateSuffix != "" {
+		templateSuffix = "." + conf.TemplateSuffix
+	}
+
+	suppressed := map[string]string{}
+
 	for _, group := range groups {
-		resolveSources(dotfiles, sources, lockfile.InstalledFiles, group)
+		resolveSources(dotfiles, sources, lockfile.InstalledFiles, group, templateSuffix)
 		resolveOverrides(dotfiles, "."+conf.OverrideSuffix)
+
+		if conf.PatchSuffix != "" {
+			resolvePatches(dotfiles, "."+conf.PatchSuffix, lockfile)
+		}
+
+		if conf.RemoveSuffix != "" {
+			resolveWhiteouts(dotfiles, suppressed, "."+conf.RemoveSuffix)
+		}
 	}
 
-	// Install scripts and removed files can be computed after all dotfiles have
-	// been cascaded together
+	// Install scripts can be computed after all dotfiles have been cascaded
+	// together
 	resolveInstallScripts(dotfiles, "."+conf.InstallSuffix)
-	resolveRemoved(dotfiles, lockfile.InstalledFiles)
 
 	// Mark dotfiles which will have environment expansion
 	resolveExpandEnv(dotfiles, conf.ExpandEnvironment)
 
+	// Mark dotfiles which will be rendered as templates
+	resolveTemplates(dotfiles, conf.Templates)
+
+	// Mark dotfiles which will be combined byte-for-byte
+	resolvePreserveWhitespace(dotfiles, conf.PreserveWhitespace)
+
+	// Determine how dotfiles with multiple sources will be merged
+	resolveMergeStrategies(dotfiles, conf.Merge)
+
+	// Mark how dotfiles will be installed
+	resolveInstallMode(dotfiles, conf.InstallMode)
+
+	// Apply file rules, which may also change the path dotfiles are installed
+	// to. Removed files must be computed after dotfiles have been moved into
+	// their install targets.
+	applicable := applicableRules(conf.Files, lockfile.ResolveFacts(conf))
+	locations := resolveFileRules(dotfiles, conf.Files, applicable)
+
+	resolveInstallTargets(dotfiles, conf, locations, lockfile)
+	resolveDirectoryModes(dotfiles, conf.Files, applicable)
+
+	resolveSuppressed(dotfiles, suppressed, conf, lockfile)
+	resolveRemoved(dotfiles, conf, lockfile)
+
+	// Managed links are resolved once all dotfiles are known
+	resolveLinks(dotfiles, conf.ResolveLinks(groups), lockfile.InstalledLinks)
+
 	return dotfiles.asList()
 }
@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"fmt"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -10,14 +11,28 @@ import (
 )
 
 func TestResolveDotfiles(t *testing.T) {
+	enabled, disabled := true, false
+
 	tests := []struct {
 		CaseName       string
 		SourceFiles    []string
 		ExistingFiles  []string
 		Groups         []string
 		ExpandEnv      []string
+		Templates      []string
+		Preserve       []string
+		Files          []config.FileRule
+		Targets        map[string]config.InstallTarget
+		Installed      map[string]config.InstalledTarget
+		Links          map[string]string
+		GroupLinks     map[string]map[string]string
+		ExistingLinks  []string
+		Merge          map[string]config.MergeStrategy
 		OverrideSuffix string
 		InstallSuffix  string
+		TemplateSuffix string
+		RemoveSuffix   string
+		PatchSuffix    string
 		Expected       Dotfiles
 	}{
 		{
@@ -261,6 +276,504 @@ func TestResolveDotfiles(t *testing.T) {
 				},
 			},
 		},
+		{
+			CaseName: "Template sources",
+			SourceFiles: []string{
+				"base/gitconfig.tmpl",
+				"machines/desktop/gitconfig",
+				"base/bashrc",
+				"machines/desktop/bashrc.override.tmpl",
+				"base/vimrc",
+			},
+			ExistingFiles:  []string{},
+			Groups:         []string{"base", "machines/desktop"},
+			Templates:      []string{"vimrc"},
+			TemplateSuffix: "tmpl",
+			Expected: Dotfiles{
+				{
+					Path:  "bashrc",
+					Added: true,
+					Sources: []*SourceFile{
+						{
+							Group: "base",
+							Path:  "base/bashrc",
+						},
+						{
+							Group:    "machines/desktop",
+							Path:     "machines/desktop/bashrc.override.tmpl",
+							Override: true,
+							Template: true,
+						},
+					},
+				},
+				{
+					Path:  "gitconfig",
+					Added: true,
+					Sources: []*SourceFile{
+						{
+							Group:    "base",
+							Path:     "base/gitconfig.tmpl",
+							Template: true,
+						},
+						{
+							Group: "machines/desktop",
+							Path:  "machines/desktop/gitconfig",
+						},
+					},
+				},
+				{
+					Path:     "vimrc",
+					Added:    true,
+					Template: true,
+					Sources: []*SourceFile{
+						{
+							Group: "base",
+							Path:  "base/vimrc",
+						},
+					},
+				},
+			},
+		},
+		{
+			CaseName: "Merge strategies",
+			SourceFiles: []string{
+				"base/settings.json",
+				"machines/desktop/settings.json",
+				"base/single.json",
+				"base/data.conf",
+				"machines/desktop/data.conf",
+				"base/concat.yml",
+				"machines/desktop/concat.yml",
+			},
+			ExistingFiles: []string{},
+			Groups:        []string{"base", "machines/desktop"},
+			Merge: map[string]config.MergeStrategy{
+				"data.conf":  config.MergeINI,
+				"concat.yml": config.MergeConcat,
+			},
+			Expected: Dotfiles{
+				{
+					Path:  "concat.yml",
+					Added: true,
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/concat.yml"},
+						{Group: "machines/desktop", Path: "machines/desktop/concat.yml"},
+					},
+				},
+				{
+					Path:          "data.conf",
+					Added:         true,
+					MergeStrategy: config.MergeINI,
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/data.conf"},
+						{Group: "machines/desktop", Path: "machines/desktop/data.conf"},
+					},
+				},
+				{
+					Path:          "settings.json",
+					Added:         true,
+					MergeStrategy: config.MergeJSON,
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/settings.json"},
+						{Group: "machines/desktop", Path: "machines/desktop/settings.json"},
+					},
+				},
+				{
+					Path:  "single.json",
+					Added: true,
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/single.json"},
+					},
+				},
+			},
+		},
+		{
+			CaseName: "Whiteout files",
+			SourceFiles: []string{
+				"base/X11/xinitrc",
+				"base/X11/xresources",
+				"base/X11/colors/dark",
+				"base/bashrc",
+				"base/vimrc",
+				"machines/server/X11/xinitrc.remove",
+				"machines/server/X11/colors.remove",
+				"machines/server/vimrc.remove",
+				"machines/server/nothing.remove",
+				"machines/laptop/vimrc",
+			},
+			ExistingFiles: []string{"X11/xinitrc"},
+			Groups:        []string{"base", "machines/server", "machines/laptop"},
+			RemoveSuffix:  "remove",
+			Expected: Dotfiles{
+				{
+					Path:         "X11/colors/dark",
+					Suppressed:   true,
+					SuppressedBy: "machines/server/X11/colors.remove",
+				},
+				{
+					Path:         "X11/xinitrc",
+					Removed:      true,
+					Suppressed:   true,
+					SuppressedBy: "machines/server/X11/xinitrc.remove",
+				},
+				{
+					Path:  "X11/xresources",
+					Added: true,
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/X11/xresources"},
+					},
+				},
+				{
+					Path:  "bashrc",
+					Added: true,
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/bashrc"},
+					},
+				},
+				{
+					Path:  "vimrc",
+					Added: true,
+					Sources: []*SourceFile{
+						{Group: "machines/laptop", Path: "machines/laptop/vimrc"},
+					},
+				},
+			},
+		},
+		{
+			CaseName: "Patch sources",
+			SourceFiles: []string{
+				"base/bashrc",
+				"machines/desktop/bashrc.patch",
+				"machines/desktop/inputrc.patch",
+			},
+			ExistingFiles: []string{"inputrc"},
+			Groups:        []string{"base", "machines/desktop"},
+			PatchSuffix:   "patch",
+			Expected: Dotfiles{
+				{
+					Path:  "bashrc",
+					Added: true,
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/bashrc"},
+						{Group: "machines/desktop", Path: "machines/desktop/bashrc.patch", Patch: true},
+					},
+				},
+				{
+					Path:  "inputrc",
+					Added: false,
+					Sources: []*SourceFile{
+						{Group: "machines/desktop", Path: "machines/desktop/inputrc.patch", Patch: true},
+					},
+				},
+			},
+		},
+		{
+			CaseName: "Preserved whitespace",
+			SourceFiles: []string{
+				"base/Makefile",
+				"base/bashrc",
+			},
+			ExistingFiles: []string{},
+			Groups:        []string{"base"},
+			Preserve:      []string{"Makefile", "missing"},
+			Expected: Dotfiles{
+				{
+					Path:               "Makefile",
+					Added:              true,
+					PreserveWhitespace: true,
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/Makefile"},
+					},
+				},
+				{
+					Path:  "bashrc",
+					Added: true,
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/bashrc"},
+					},
+				},
+			},
+		},
+		{
+			CaseName: "File rules",
+			SourceFiles: []string{
+				"base/bin/run.sh",
+				"base/bin/build.sh",
+				"base/ssh/config",
+				"base/settings.json",
+				"machines/desktop/settings.json",
+				"base/profile",
+			},
+			ExistingFiles: []string{"profile"},
+			Groups:        []string{"base", "machines/desktop"},
+			Files: []config.FileRule{
+				{Match: "bin/*.sh", Mode: "0755", Template: &enabled},
+				{Match: "build.sh", Template: &disabled},
+				{Match: "ssh/**", Mode: "0600", When: []string{"group machines/desktop"}},
+				{Match: "ssh/config", Mode: "0644", When: []string{"not group machines/desktop"}},
+				{Match: "*.json", Merge: config.MergeConcat},
+				{Match: "profile", Target: "bash/", ExpandEnvironment: &enabled},
+				{Match: "ssh", DirectoryMode: "0700"},
+				{Match: "bin/**", InstallMode: config.InstallLink},
+			},
+			Expected: Dotfiles{
+				{
+					Path:         "bash/profile",
+					Added:        true,
+					ExpandEnv:    true,
+					OriginalPath: "profile",
+					Rules:        []int{5},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/profile"},
+					},
+				},
+				{
+					Path:        "bin/build.sh",
+					Added:       true,
+					Mode:        0755,
+					InstallMode: config.InstallLink,
+					Rules:       []int{0, 1, 7},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/bin/build.sh"},
+					},
+				},
+				{
+					Path:        "bin/run.sh",
+					Added:       true,
+					Mode:        0755,
+					Template:    true,
+					InstallMode: config.InstallLink,
+					Rules:       []int{0, 7},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/bin/run.sh"},
+					},
+				},
+				{
+					Path:    "profile",
+					Removed: true,
+				},
+				{
+					Path:  "settings.json",
+					Added: true,
+					Rules: []int{4},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/settings.json"},
+						{Group: "machines/desktop", Path: "machines/desktop/settings.json"},
+					},
+				},
+				{
+					Path:  "ssh/config",
+					Added: true,
+					Mode:  0600,
+					Rules: []int{2},
+					DirectoryModes: map[string]os.FileMode{
+						"ssh": 0700,
+					},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/ssh/config"},
+					},
+				},
+			},
+		},
+		{
+			CaseName: "Install targets",
+			SourceFiles: []string{
+				"base/git/config",
+				"base/home/.bashrc",
+				"base/home/.ssh/config",
+				"base/scripts/backup",
+			},
+			ExistingFiles: []string{"git/config", "home/.profile"},
+			Installed: map[string]config.InstalledTarget{
+				"home": {Path: "/home", Files: []string{".bashrc", ".old"}},
+				"bin":  {Path: "/home/.local/bin", Files: []string{"backup"}},
+				"gone": {Path: "/opt", Files: []string{"tool"}},
+			},
+			Groups: []string{"base"},
+			Targets: map[string]config.InstallTarget{
+				"home": {Path: "/home", Directory: "home"},
+				"bin":  {Path: "/home/.local/bin"},
+			},
+			Files: []config.FileRule{
+				{Match: "scripts/*", InstallTarget: "bin", Target: "./"},
+				{Match: ".ssh", DirectoryMode: "0700"},
+			},
+			Expected: Dotfiles{
+				{
+					Path: "git/config",
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/git/config"},
+					},
+				},
+				{
+					Path:    "home/.profile",
+					Removed: true,
+				},
+				{
+					Path:          "backup",
+					InstallTarget: "bin",
+					OriginalPath:  "scripts/backup",
+					Rules:         []int{0},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/scripts/backup"},
+					},
+				},
+				{
+					Path:          "tool",
+					InstallTarget: "gone",
+					Removed:       true,
+				},
+				{
+					Path:          ".bashrc",
+					InstallTarget: "home",
+					OriginalPath:  "home/.bashrc",
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/home/.bashrc"},
+					},
+				},
+				{
+					Path:          ".old",
+					InstallTarget: "home",
+					Removed:       true,
+				},
+				{
+					Path:          ".ssh/config",
+					InstallTarget: "home",
+					Added:         true,
+					OriginalPath:  "home/.ssh/config",
+					DirectoryModes: map[string]os.FileMode{
+						".ssh": 0700,
+					},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/home/.ssh/config"},
+					},
+				},
+			},
+		},
+		{
+			CaseName: "Colliding destinations",
+			SourceFiles: []string{
+				"base/a",
+				"base/b",
+				"base/c",
+				"base/e",
+				"base/home/.x",
+				"base/x",
+			},
+			ExistingFiles: []string{"a", "b", "c", "e", "x"},
+			Groups:        []string{"base"},
+			Targets: map[string]config.InstallTarget{
+				"home": {Path: "/home", Directory: "home"},
+			},
+			Files: []config.FileRule{
+				{Match: "a", Target: "b"},
+				{Match: "b", Target: "d"},
+				{Match: "e", Target: "c"},
+				{Match: "x", InstallTarget: "home", Target: ".x"},
+			},
+			Expected: Dotfiles{
+				{
+					Path:    "a",
+					Removed: true,
+				},
+				{
+					Path:         "b",
+					OriginalPath: "a",
+					Rules:        []int{0},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/a"},
+					},
+				},
+				{
+					Path: "c",
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/c"},
+					},
+				},
+				{
+					Path:         "d",
+					Added:        true,
+					OriginalPath: "b",
+					Rules:        []int{1},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/b"},
+					},
+				},
+				{
+					Path:         "e",
+					Collision:    "c",
+					CollidesWith: "c",
+					Rules:        []int{2},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/e"},
+					},
+				},
+				{
+					Path:         "x",
+					Collision:    "home:.x",
+					CollidesWith: "home/.x",
+					Rules:        []int{3},
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/x"},
+					},
+				},
+				{
+					Path:          ".x",
+					InstallTarget: "home",
+					Added:         true,
+					OriginalPath:  "home/.x",
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/home/.x"},
+					},
+				},
+			},
+		},
+		{
+			CaseName:    "Managed links",
+			SourceFiles: []string{"base/bash/bashrc", "machines/desktop/git/config"},
+			Groups:      []string{"base", "machines/desktop"},
+			Links: map[string]string{
+				"/home/.bashrc":    "bash/bashrc",
+				"/home/.gitconfig": "git/config",
+			},
+			GroupLinks: map[string]map[string]string{
+				"machines/desktop": {"/home/.gitconfig": "git/config-desktop"},
+				"machines/laptop":  {"/home/.laptop": "laptop"},
+			},
+			ExistingLinks: []string{"/home/.bashrc", "/home/.vimrc"},
+			Expected: Dotfiles{
+				{
+					Path:  "bash/bashrc",
+					Added: true,
+					Sources: []*SourceFile{
+						{Group: "base", Path: "base/bash/bashrc"},
+					},
+				},
+				{
+					Path:  "git/config",
+					Added: true,
+					Sources: []*SourceFile{
+						{Group: "machines/desktop", Path: "machines/desktop/git/config"},
+					},
+				},
+				{
+					Path:          "/home/.bashrc",
+					ManagedLink:   true,
+					LinkedDotfile: "bash/bashrc",
+				},
+				{
+					Path:          "/home/.gitconfig",
+					Added:         true,
+					ManagedLink:   true,
+					LinkedDotfile: "git/config-desktop",
+				},
+				{
+					Path:        "/home/.vimrc",
+					Removed:     true,
+					ManagedLink: true,
+				},
+			},
+		},
 	}
 
 	origSourceLoader := sourceLoader
@@ -276,15 +789,27 @@ func TestResolveDotfiles(t *testing.T) {
 		}
 
 		conf := config.SourceConfig{
-			BaseGroups:        []string{},
-			OverrideSuffix:    test.OverrideSuffix,
-			InstallSuffix:     test.InstallSuffix,
-			ExpandEnvironment: test.ExpandEnv,
+			BaseGroups:         []string{},
+			OverrideSuffix:     test.OverrideSuffix,
+			InstallSuffix:      test.InstallSuffix,
+			TemplateSuffix:     test.TemplateSuffix,
+			RemoveSuffix:       test.RemoveSuffix,
+			PatchSuffix:        test.PatchSuffix,
+			ExpandEnvironment:  test.ExpandEnv,
+			Templates:          test.Templates,
+			PreserveWhitespace: test.Preserve,
+			Files:              test.Files,
+			Targets:            test.Targets,
+			Links:              test.Links,
+			GroupLinks:         test.GroupLinks,
+			Merge:              test.Merge,
 		}
 
 		lockfile := config.SourceLockfile{
-			InstalledFiles: test.ExistingFiles,
-			Groups:         test.Groups,
+			InstalledFiles:   test.ExistingFiles,
+			InstalledTargets: test.Installed,
+			InstalledLinks:   test.ExistingLinks,
+			Groups:           test.Groups,
 		}
 
 		sourceLoader = func(path string) []string {
@@ -338,6 +863,10 @@ func TestDotfilesFiles(t *testing.T) {
 		{
 			Path: "something/else",
 		},
+		{
+			Path:       "suppressed",
+			Suppressed: true,
+		},
 	}
 
 	dotfileFiles := dotfiles.Files()
@@ -403,3 +932,60 @@ func TestDotfilesFilter(t *testing.T) {
 		}
 	}
 }
+
+func TestDotfileActiveSources(t *testing.T) {
+	base := &SourceFile{Group: "base", Path: "base/bashrc"}
+	desktop := &SourceFile{Group: "machines/desktop", Path: "machines/desktop/bashrc.override", Override: true}
+	laptop := &SourceFile{Group: "machines/laptop", Path: "machines/laptop/bashrc"}
+	server := &SourceFile{Group: "machines/server", Path: "machines/server/bashrc.override", Override: true}
+
+	tests := []struct {
+		sources      []*SourceFile
+		active       []*SourceFile
+		discarded    []*SourceFile
+		overriddenBy *SourceFile
+	}{
+		{
+			[]*SourceFile{base, laptop},
+			[]*SourceFile{base, laptop},
+			nil,
+			nil,
+		},
+		{
+			[]*SourceFile{desktop, laptop},
+			[]*SourceFile{desktop, laptop},
+			nil,
+			nil,
+		},
+		{
+			[]*SourceFile{base, desktop, laptop},
+			[]*SourceFile{desktop, laptop},
+			[]*SourceFile{base},
+			desktop,
+		},
+		{
+			[]*SourceFile{base, desktop, laptop, server},
+			[]*SourceFile{server},
+			[]*SourceFile{base, desktop, laptop},
+			server,
+		},
+	}
+
+	for _, test := range tests {
+		dotfile := &Dotfile{Sources: test.sources}
+
+		if active := dotfile.ActiveSources(); !reflect.DeepEqual(active, test.active) {
+			t.Errorf("Expected active = %v; got = %v", test.active, active)
+		}
+
+		discarded, overriddenBy := dotfile.DiscardedSources()
+
+		if !reflect.DeepEqual(discarded, test.discarded) {
+			t.Errorf("Expected discarded = %v; got = %v", test.discarded, discarded)
+		}
+
+		if overriddenBy != test.overriddenBy {
+			t.Errorf("Expected overriddenBy = %v; got = %v", test.overriddenBy, overriddenBy)
+		}
+	}
+}